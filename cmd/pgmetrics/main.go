@@ -24,11 +24,15 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/pborman/getopt"
 	"github.com/rapidloop/pgmetrics"
 	"github.com/rapidloop/pgmetrics/collector"
+	"github.com/rapidloop/pgmetrics/prometheus"
 	"golang.org/x/term"
 )
 
@@ -72,9 +76,25 @@ Collection options:
       --aws-rds-dbid           AWS RDS/Aurora database instance identifier
       --az-resource            Azure resource ID
       --pgpool                 collect only Pgpool metrics
+      --statfs-timeout=SECS    give up on getting disk space of a tablespace
+                                   after SECS seconds, 0 for no timeout
+                                   (default: 5)
+      --disk-devices=GLOBS     collect I/O stats only for disk devices matching
+                                   any of these comma-separated glob patterns
+      --exclude-disk-majors=LIST
+                               do NOT collect I/O stats for disk devices with
+                                   these comma-separated major numbers
+      --disk-sample=SECS       sample disk I/O and paging stats twice, SECS
+                                   seconds apart, to report I/O and swapping
+                                   rates (default: 0, no sampling)
+      --proc-root=DIR          read /proc (and /etc/os-release) files from
+                                   under DIR, like a copy from another host;
+                                   skips postmaster and cgroup metrics
+      --sys-root=DIR           read /sys files from under DIR
 
 Output options:
-  -f, --format=FORMAT          output format; "human", "json" or "csv" (default: "human")
+  -f, --format=FORMAT          output format; "human", "json", "csv" or
+                                   "prometheus" (default: "human")
   -l, --toolong=SECS           for human output, transactions running longer than
                                    this are considered too long (default: 60)
   -o, --output=FILE            write output to the specified file
@@ -155,6 +175,9 @@ type options struct {
 	// connection
 	passNone   bool
 	queryProto string
+	// collection
+	exclDiskMajors []string
+	diskSampleSec  uint
 }
 
 func (o *options) defaults() {
@@ -173,6 +196,9 @@ func (o *options) defaults() {
 	// connection
 	o.passNone = false
 	o.queryProto = "simple"
+	// collection
+	o.exclDiskMajors = nil
+	o.diskSampleSec = 0
 }
 
 func (o *options) usage(code int) {
@@ -227,6 +253,12 @@ func (o *options) parse() (args []string) {
 	s.StringVarLong(&o.CollectConfig.RDSDBIdentifier, "aws-rds-dbid", 0, "")
 	s.StringVarLong(&o.CollectConfig.AzureResourceID, "az-resource", 0, "")
 	s.BoolVarLong(&o.CollectConfig.Pgpool, "pgpool", 0, "").SetFlag()
+	s.UintVarLong(&o.CollectConfig.StatFSTimeoutSec, "statfs-timeout", 0, "")
+	s.ListVarLong(&o.CollectConfig.DiskDeviceFilter, "disk-devices", 0, "")
+	s.ListVarLong(&o.exclDiskMajors, "exclude-disk-majors", 0, "")
+	s.UintVarLong(&o.diskSampleSec, "disk-sample", 0, "")
+	s.StringVarLong(&o.CollectConfig.ProcRoot, "proc-root", 0, "")
+	s.StringVarLong(&o.CollectConfig.SysRoot, "sys-root", 0, "")
 	// output
 	s.StringVarLong(&o.format, "format", 'f', "")
 	s.StringVarLong(&o.output, "output", 'o', "")
@@ -251,8 +283,9 @@ func (o *options) parse() (args []string) {
 		printTry()
 		os.Exit(2)
 	}
-	if o.format != "human" && o.format != "json" && o.format != "csv" {
-		fmt.Fprintln(os.Stderr, `option -f/--format must be "human", "json" or "csv"`)
+	if o.format != "human" && o.format != "json" && o.format != "csv" &&
+		o.format != "prometheus" {
+		fmt.Fprintln(os.Stderr, `option -f/--format must be "human", "json", "csv" or "prometheus"`)
 		printTry()
 		os.Exit(2)
 	}
@@ -301,6 +334,23 @@ func (o *options) parse() (args []string) {
 			os.Exit(2)
 		}
 	}
+	for _, pattern := range o.CollectConfig.DiskDeviceFilter {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "bad glob pattern %q in --disk-devices option\n", pattern)
+			printTry()
+			os.Exit(2)
+		}
+	}
+	for _, ms := range o.exclDiskMajors {
+		m, err := strconv.Atoi(ms)
+		if err != nil || m < 0 {
+			fmt.Fprintf(os.Stderr, "bad major number \"%s\" in --exclude-disk-majors option\n", ms)
+			printTry()
+			os.Exit(2)
+		}
+		o.CollectConfig.ExcludeDiskMajors = append(o.CollectConfig.ExcludeDiskMajors, m)
+	}
+	o.CollectConfig.DiskSampleInterval = time.Duration(o.diskSampleSec) * time.Second
 	if o.queryProto != "simple" && o.queryProto != "extended" {
 		fmt.Fprintln(os.Stderr, `option --query-proto must be "simple" or "extended"`)
 		printTry()
@@ -333,6 +383,8 @@ func writeTo(fd io.Writer, o options, result *pgmetrics.Model) {
 		writeJSONTo(fd, result)
 	case "csv":
 		writeCSVTo(fd, result)
+	case "prometheus":
+		writePrometheusTo(fd, result)
 	default:
 		writeHumanTo(fd, o, result)
 	}
@@ -354,6 +406,12 @@ func writeCSVTo(fd io.Writer, result *pgmetrics.Model) {
 	w.Flush()
 }
 
+func writePrometheusTo(fd io.Writer, result *pgmetrics.Model) {
+	if err := prometheus.WritePrometheus(fd, result); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func process(result *pgmetrics.Model, o options, args []string) {
 	if o.output == "-" {
 		o.output = ""
@@ -246,7 +246,7 @@ func reportReplicationSlots(fd io.Writer, result *pgmetrics.Model, version int)
 Physical Replication Slots:
 `)
 		var tw tableWriter
-		cols := []interface{}{"Name", "Active", "Oldest Txn ID", "Restart LSN"}
+		cols := []interface{}{"Name", "Active", "Oldest Txn ID", "Restart LSN", "Retained WAL"}
 		if version >= pgv10 {
 			cols = append(cols, "Temporary")
 		}
@@ -256,7 +256,7 @@ Physical Replication Slots:
 				continue
 			}
 			vals := []interface{}{r.SlotName, fmtYesNo(r.Active),
-				fmtIntZero(r.Xmin), r.RestartLSN}
+				fmtIntZero(r.Xmin), r.RestartLSN, fmtRetainedWAL(r.RetainedWALBytes)}
 			if version >= pgv10 {
 				vals = append(vals, fmtYesNo(r.Temporary))
 			}
@@ -270,7 +270,7 @@ Logical Replication Slots:
 `)
 		var tw tableWriter
 		cols := []interface{}{"Name", "Plugin", "Database", "Active",
-			"Oldest Txn ID", "Restart LSN", "Flushed Until"}
+			"Oldest Txn ID", "Restart LSN", "Flushed Until", "Retained WAL"}
 		if version >= pgv10 {
 			cols = append(cols, "Temporary")
 		}
@@ -281,7 +281,7 @@ Logical Replication Slots:
 			}
 			vals := []interface{}{r.SlotName, r.Plugin, r.DBName,
 				fmtYesNo(r.Active), fmtIntZero(r.Xmin), r.RestartLSN,
-				r.ConfirmedFlushLSN}
+				r.ConfirmedFlushLSN, fmtRetainedWAL(r.RetainedWALBytes)}
 			if version >= pgv10 {
 				vals = append(vals, fmtYesNo(r.Temporary))
 			}
@@ -289,6 +289,29 @@ Logical Replication Slots:
 		}
 		tw.write(fd, "    ")
 	}
+	if wr := result.WALRetention; wr != nil && wr.TotalRetainedWALBytes > 0 {
+		fmt.Fprintf(fd, `
+WAL Retained by Replication Slots:
+    Total Retained:      %s`,
+			humanize.IBytes(uint64(wr.TotalRetainedWALBytes)))
+		if du := result.WALDirDisk; result.Metadata.Local && du != nil && du.DiskTotal > 0 {
+			var pressure string
+			if wr.WALDiskPressure {
+				pressure = ", WAL disk is over 80% full with WAL retained by slots"
+			}
+			fmt.Fprintf(fd, `
+    WAL Disk Pressure?   %s%s`,
+				fmtYesNo(wr.WALDiskPressure), pressure)
+		}
+		fmt.Fprintln(fd)
+	}
+}
+
+func fmtRetainedWAL(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	return humanize.IBytes(uint64(n))
 }
 
 // WAL files and archiving
@@ -772,12 +795,12 @@ Tablespaces:
 `)
 	var tw tableWriter
 	if result.Metadata.Local {
-		tw.add("Name", "Owner", "Location", "Size", "Disk Used", "Inode Used")
+		tw.add("Name", "Owner", "Location", "Size", "Disk Used", "Disk Avail", "Inode Used")
 	} else {
 		tw.add("Name", "Owner", "Location", "Size")
 	}
 	for _, t := range result.Tablespaces {
-		var s, du, iu string
+		var s, du, da, iu string
 		if t.Size != -1 {
 			s = humanize.IBytes(uint64(t.Size))
 		}
@@ -786,6 +809,12 @@ Tablespaces:
 				humanize.IBytes(uint64(t.DiskUsed)),
 				100*safeDiv(t.DiskUsed, t.DiskTotal),
 				humanize.IBytes(uint64(t.DiskTotal)))
+			if t.SharesStorage {
+				du += " (shared)"
+			}
+		}
+		if result.Metadata.Local && t.DiskTotal > 0 && (t.DiskAvailable > 0 || t.DiskReserved > 0) {
+			da = humanize.IBytes(uint64(t.DiskAvailable))
 		}
 		if result.Metadata.Local && t.InodesUsed > 0 && t.InodesTotal > 0 {
 			iu = fmt.Sprintf("%d (%.1f%%) of %d",
@@ -797,7 +826,7 @@ Tablespaces:
 			t.Location = "$PGDATA = " + t.Location
 		}
 		if result.Metadata.Local {
-			tw.add(t.Name, t.Owner, t.Location, s, du, iu)
+			tw.add(t.Name, t.Owner, t.Location, s, du, da, iu)
 		} else {
 			tw.add(t.Name, t.Owner, t.Location, s)
 		}
@@ -1395,21 +1424,100 @@ func reportSystem(fd io.Writer, result *pgmetrics.Model) {
 	fmt.Fprintf(fd, `
 System Information:
     Hostname:            %s
-    CPU Cores:           %d x %s
-    Load Average:        %.2f
-    Memory:              used=%s, free=%s, buff=%s, cache=%s
-    Swap:                used=%s, free=%s
 `,
 		s.Hostname,
-		s.NumCores, s.CPUModel,
-		s.LoadAvg,
-		humanize.IBytes(uint64(s.MemUsed)),
-		humanize.IBytes(uint64(s.MemFree)),
-		humanize.IBytes(uint64(s.MemBuffers)),
-		humanize.IBytes(uint64(s.MemCached)),
-		humanize.IBytes(uint64(s.SwapUsed)),
-		humanize.IBytes(uint64(s.SwapFree)),
 	)
+	// not collected on all platforms (like macOS), where these are zero
+	if s.NumCores > 0 {
+		fmt.Fprintf(fd, `    CPU Cores:           %d x %s
+    Load Average:        %.2f
+`,
+			s.NumCores, s.CPUModel,
+			s.LoadAvg,
+		)
+	}
+	if s.MemUsed > 0 || s.MemFree > 0 {
+		fmt.Fprintf(fd, `    Memory:              used=%s, free=%s, buff=%s, cache=%s
+    Swap:                used=%s, free=%s
+`,
+			humanize.IBytes(uint64(s.MemUsed)),
+			humanize.IBytes(uint64(s.MemFree)),
+			humanize.IBytes(uint64(s.MemBuffers)),
+			humanize.IBytes(uint64(s.MemCached)),
+			humanize.IBytes(uint64(s.SwapUsed)),
+			humanize.IBytes(uint64(s.SwapFree)),
+		)
+	}
+	if s.SwapInRate > 0 || s.SwapOutRate > 0 {
+		fmt.Fprintf(fd, "    Swap Activity:       in=%.1f pages/s, out=%.1f pages/s\n",
+			s.SwapInRate, s.SwapOutRate)
+	}
+	if s.OSName != "" || s.KernelRelease != "" {
+		fmt.Fprintf(fd, "    OS:                  %s\n", fmtOSInfo(s))
+	}
+	if s.CgroupMemLimit > 0 {
+		fmt.Fprintf(fd, "    Cgroup Memory:       used=%s, limit=%s\n",
+			humanize.IBytes(uint64(s.CgroupMemUsed)),
+			humanize.IBytes(uint64(s.CgroupMemLimit)))
+	}
+	if s.CgroupCPULimit > 0 {
+		fmt.Fprintf(fd, "    Cgroup CPU Limit:    %.2f cores\n", s.CgroupCPULimit)
+	}
+	if pm := s.Postmaster; pm != nil {
+		fmt.Fprintf(fd, "    Postmaster:          rss=%s, threads=%d, fds=%s\n",
+			humanize.IBytes(uint64(pm.RSS)), pm.NumThreads, fmtFDCount(pm.NumFDs))
+	}
+	if pp := result.PostgresProcess; pp != nil {
+		fmt.Fprintf(fd, "    Postmaster Files:    open=%d, limit=%s (soft), %s (hard)\n",
+			pp.PostmasterFDCurrent, fmtLimit(pp.PostmasterFDSoftLimit),
+			fmtLimit(pp.PostmasterFDHardLimit))
+	}
+	if ch := s.PostmasterChildren; ch != nil {
+		fmt.Fprintf(fd, "    Postmaster Children: %d processes, rss=%s, fds=%s\n",
+			ch.NumProcesses, humanize.IBytes(uint64(ch.RSS)), fmtFDCount(ch.NumFDs))
+	}
+	if len(s.NUMANodes) > 1 {
+		for _, n := range s.NUMANodes {
+			fmt.Fprintf(fd, "    %-21s%d cpus, used=%s, free=%s\n",
+				fmt.Sprintf("NUMA Node %d:", n.NodeID), len(n.CPUs),
+				humanize.IBytes(uint64(n.MemUsedBytes)),
+				humanize.IBytes(uint64(n.MemFreeBytes)))
+		}
+	}
+	if ts := s.TCPStats; ts != nil {
+		fmt.Fprintf(fd, "    TCP Sockets:         inuse=%d, orphan=%d, timewait=%d",
+			ts.TCPInUse+ts.TCP6InUse, ts.TCPOrphan, ts.TCPTimewait)
+		if n := ts.EphemeralPortMax - ts.EphemeralPortMin + 1; ts.EphemeralPortMax > 0 && n > 0 {
+			fmt.Fprintf(fd, " (%.1f%% of %d ephemeral ports)",
+				100*safeDiv(ts.TCPTimewait, int64(n)), n)
+		}
+		fmt.Fprintln(fd)
+	}
+	for i, sn := range s.Sensors {
+		label := "Temperatures:"
+		if i > 0 {
+			label = ""
+		}
+		fmt.Fprintf(fd, "    %-21s%s %s (%s/%s): %.1f C", label, sn.Name, sn.Label,
+			sn.Device, sn.ID, sn.TempCelsius)
+		if sn.CritCelsius > 0 {
+			fmt.Fprintf(fd, " (crit %.1f C)", sn.CritCelsius)
+		}
+		fmt.Fprintln(fd)
+	}
+	if du := result.DataDirDisk; du != nil && du.DiskTotal > 0 {
+		fmt.Fprintf(fd, "    Data Dir Disk:       %s\n", fmtDiskUsage(*du))
+	}
+	if du := result.WALDirDisk; du != nil && du.DiskTotal > 0 {
+		fmt.Fprintf(fd, "    WAL Dir Disk:        %s\n", fmtDiskUsage(*du))
+	}
+	for i, w := range s.Warnings {
+		if i == 0 {
+			fmt.Fprintf(fd, "    Warnings:            %s\n", w)
+		} else {
+			fmt.Fprintf(fd, "                         %s\n", w)
+		}
+	}
 	var tw tableWriter
 	tw.add("Setting", "Value")
 	add := func(k string) { tw.add(k, getSetting(result, k)) }
@@ -1726,6 +1834,47 @@ func getSettingBytes(result *pgmetrics.Model, key string, factor uint64) string
 	return s + " (" + humanize.IBytes(val*factor) + ")"
 }
 
+func fmtLimit(n int64) string {
+	switch n {
+	case -1:
+		return "unlimited"
+	case 0:
+		return "?"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func fmtOSInfo(s *pgmetrics.SystemMetrics) string {
+	name := s.OSName
+	if name == "" {
+		name = "?"
+	}
+	if s.KernelRelease != "" {
+		name += ", kernel " + s.KernelRelease
+	}
+	return name
+}
+
+func fmtFDCount(n int64) string {
+	if n == 0 {
+		return "?" // not accessible
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func fmtDiskUsage(du pgmetrics.DiskUsage) string {
+	var avail string
+	if du.DiskAvailable > 0 || du.DiskReserved > 0 {
+		avail = ", " + humanize.IBytes(uint64(du.DiskAvailable)) + " available"
+	}
+	return fmt.Sprintf("%s (%.1f%%) of %s%s, at %s",
+		humanize.IBytes(uint64(du.DiskUsed)),
+		100*safeDiv(du.DiskUsed, du.DiskTotal),
+		humanize.IBytes(uint64(du.DiskTotal)),
+		avail,
+		du.Path)
+}
+
 func safeDiv(a, b int64) float64 {
 	if b == 0 {
 		return 0
@@ -69,7 +69,7 @@ func (c *collector) getCitus(currdb string, fillSize bool) {
 }
 
 func (c *collector) getCitusVersion(currdb string, major *int) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	var cv string
@@ -86,7 +86,7 @@ func (c *collector) getCitusVersion(currdb string, major *int) {
 }
 
 func (c *collector) getCitusTableSizes(currdb string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT logicalrelid::oid, citus_table_size(logicalrelid) FROM pg_dist_partition`
@@ -117,7 +117,7 @@ func (c *collector) getCitusTableSizes(currdb string) {
 }
 
 func (c *collector) getCitusNodes(currdb string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT nodeid, groupid, nodename, nodeport, COALESCE(noderack, ''),
@@ -147,7 +147,7 @@ func (c *collector) getCitusNodes(currdb string) {
 
 // citus_stat_statements
 func (c *collector) getCitusStatements(currdb string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT queryid, userid, dbid, query, executor, COALESCE(partition_key, ''), calls
@@ -178,7 +178,7 @@ func (c *collector) getCitusStatements(currdb string) {
 }
 
 func (c *collector) getCitusBackendsv11() []pgmetrics.CitusBackendV11 {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(datname, ''), COALESCE(usename, ''),
@@ -223,7 +223,7 @@ func (c *collector) getCitusBackendsv11() []pgmetrics.CitusBackendV11 {
 }
 
 func (c *collector) getCitusBackends(table string) []pgmetrics.CitusBackend {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(datname, ''), COALESCE(usename, ''),
@@ -282,7 +282,7 @@ func (c *collector) getCitusActivity(currdb string, major int) {
 
 // citus_lock_waits
 func (c *collector) getCitusLocks(currdb string, majorVer int) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	var q string
@@ -352,7 +352,7 @@ SELECT p.logicalrelid::oid::int AS table_oid,
 `
 
 func (c *collector) getCitusTables(currdb string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, citusTablesSQL)
@@ -378,7 +378,7 @@ func (c *collector) getCitusTables(currdb string) {
 }
 
 func (c *collector) getCitusNodeIDs(currdb string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(citus_coordinator_nodeid(), 0), COALESCE(citus_backend_gpid(), 0)/10000000000`
@@ -19,14 +19,16 @@ package collector
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -83,6 +85,14 @@ type CollectConfig struct {
 	TimeoutSec          uint
 	LockTimeoutMillisec uint
 	NoSizes             bool
+	Context             context.Context // if nil, context.Background() is used
+
+	// if set, the collected information is also written to this, section by
+	// section as it is collected, as newline-delimited JSON objects of type
+	// pgmetrics.ModelSection. The database-specific arrays (tables, indexes
+	// etc.) are then not retained in the returned model after they are
+	// written out. See also the stream package.
+	StreamOutput io.Writer
 
 	// collection
 	Schema          string
@@ -102,6 +112,34 @@ type CollectConfig struct {
 	Pgpool          bool // collect only pgpool information
 	UseExtendedQP   bool // use extended query protocol instead of simple
 
+	// system metrics: timeout for statfs() of each tablespace location, so
+	// that an unresponsive network filesystem does not hang the collection.
+	// Zero means no timeout.
+	StatFSTimeoutSec uint
+
+	// system metrics: disk devices. Both filters are additive, a device is
+	// collected only if it passes both.
+	DiskDeviceFilter  []string // collect only devices matching one of these path.Match patterns
+	ExcludeDiskMajors []int    // do not collect devices with these major numbers
+
+	// system metrics: if non-zero, disk stats and paging counters are read
+	// twice, this far apart, and per-device I/O rates and swapping rates are
+	// computed from the difference. Zero means only the raw counters are
+	// collected.
+	DiskSampleInterval time.Duration
+
+	// system metrics: if set, files under /proc (and /etc/os-release) and
+	// /sys are read from under these directories instead, for example from
+	// an extracted copy of /proc and /sys captured on another machine. With
+	// ProcRoot set, the hostname and kernel version are also read from there
+	// rather than from the running system, and the postmaster and cgroup
+	// metrics, which need the pid of the running postmaster, are not
+	// collected. The disk usage of the tablespaces and of the data and WAL
+	// directories is always that of the running system. The defaults are
+	// empty.
+	ProcRoot string
+	SysRoot  string
+
 	// connection
 	Host     string
 	Port     uint16
@@ -117,6 +155,7 @@ func DefaultCollectConfig() CollectConfig {
 		// ------------------ general
 		TimeoutSec:          5,
 		LockTimeoutMillisec: 50,
+		StatFSTimeoutSec:    5,
 
 		// ------------------ collection
 		SQLLength:  500,
@@ -167,12 +206,44 @@ func getRegexp(r string) (rx *regexp.Regexp) {
 // If database names are specified, it connects to each in turn and accumulates
 // results. If none are specified, the connection is attempted without a
 // 'dbname' keyword (usually tries to connect to a database with same name
-// as the user).
+// as the user). If o.Context is set, it is used as in CollectWithContext.
 //
 // Ideally, this should return (*pgmetrics.Model, error). But for now, it does
 // a log.Fatal(). This will be rectified in the future, and
 // backwards-compatibility will be broken when that happens. You've been warned.
 func Collect(o CollectConfig, dbnames []string) *pgmetrics.Model {
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	result, err := CollectWithContext(ctx, o, dbnames...)
+	if err != nil {
+		log.Fatalf("collection aborted: %v", err)
+	}
+	return result
+}
+
+// CollectWithContext is like Collect, but stops the collection early if the
+// context is cancelled or its deadline expires. The context is also used as
+// the parent of the contexts for all queries and for reading system
+// information. If the collection was stopped early, the metrics collected so
+// far (if any) are returned, along with the context's error.
+//
+// An error is also returned if one of o.DiskDeviceFilter is not a valid
+// pattern. Note that other errors still result in a log.Fatal(), see Collect.
+// Queries that fail because the context was cancelled do not, the collection
+// is stopped as described above.
+func CollectWithContext(ctx context.Context, o CollectConfig, dbnames ...string) (*pgmetrics.Model, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	o.Context = ctx
+	for _, pattern := range o.DiskDeviceFilter {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad disk device pattern %q: %w", pattern, err)
+		}
+	}
+
 	// form connection string
 	var connstr string
 	mode := "postgres"
@@ -233,45 +304,102 @@ func Collect(o CollectConfig, dbnames []string) *pgmetrics.Model {
 		connstr += makeKV("default_query_exec_mode", "simple_protocol")
 	}
 
-	// if "all DBs" was specified, collect the names of databases first
-	if o.AllDBs {
-		dbnames = getDBNames(connstr, o)
-	}
-
-	// collect from 1 or more DBs
 	c := &collector{
-		dbnames: dbnames,
-		mode:    mode,
-	}
-	if len(dbnames) == 0 {
-		collectFromDB(connstr, c, o)
-	} else {
-		for _, dbname := range dbnames {
-			collectFromDB(connstr+makeKV("dbname", dbname), c, o)
-		}
+		ctx:  ctx,
+		mode: mode,
 	}
-	if !arrayHas(o.Omit, "log") && c.local {
-		// note: for rds we collect logs in the next step
-		c.collectLogs(o)
+	if o.StreamOutput != nil {
+		c.stream = json.NewEncoder(o.StreamOutput)
 	}
+	catchAbort(func() {
+		// if "all DBs" was specified, collect the names of databases first
+		if o.AllDBs {
+			dbnames = getDBNames(connstr, o)
+		}
 
-	// collect from RDS if database id is specified
-	if len(o.RDSDBIdentifier) > 0 {
-		c.collectFromRDS(o)
-	}
+		// collect from 1 or more DBs
+		c.dbnames = dbnames
+		if len(dbnames) == 0 {
+			collectFromDB(connstr, c, o)
+		} else {
+			for _, dbname := range dbnames {
+				if ctx.Err() != nil {
+					break
+				}
+				collectFromDB(connstr+makeKV("dbname", dbname), c, o)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !arrayHas(o.Omit, "log") && c.local {
+			// note: for rds we collect logs in the next step
+			c.collectLogs(o)
+		}
+
+		// collect from RDS if database id is specified
+		if len(o.RDSDBIdentifier) > 0 && ctx.Err() == nil {
+			c.collectFromRDS(o)
+		}
+
+		// collect from Azure if resource id is specified
+		if len(o.AzureResourceID) > 0 && ctx.Err() == nil {
+			c.collectFromAzure(o)
+		}
+	})
+	return c.finish()
+}
+
+// abortCollection is the value that fatalf panics with to stop the
+// collection, see catchAbort.
+type abortCollection struct{}
 
-	// collect from Azure if resource id is specified
-	if len(o.AzureResourceID) > 0 {
-		c.collectFromAzure(o)
+// fatalf is like log.Fatalf, unless ctx is done. The error being reported is
+// then most likely the result of the cancellation, and the collection is
+// stopped instead by unwinding up to catchAbort.
+func fatalf(ctx context.Context, format string, args ...interface{}) {
+	if ctx != nil && ctx.Err() != nil {
+		panic(abortCollection{})
 	}
+	log.Fatalf(format, args...)
+}
+
+// fatalf is fatalf with the collector's context.
+func (c *collector) fatalf(format string, args ...interface{}) {
+	fatalf(c.ctx, format, args...)
+}
 
-	return &c.result
+// catchAbort calls fn, and returns true if it was stopped by fatalf.
+func catchAbort(fn func()) (aborted bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(abortCollection); !ok {
+				panic(r)
+			}
+			aborted = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// finish writes out the last section in streaming mode, and returns the
+// result of CollectWithContext.
+func (c *collector) finish() (*pgmetrics.Model, error) {
+	c.writeEndSection()
+	if err := c.ctx.Err(); err != nil {
+		return &c.result, err
+	}
+	if c.streamErr != nil {
+		return &c.result, fmt.Errorf("failed to write stream output: %w", c.streamErr)
+	}
+	return &c.result, nil
 }
 
 func getConn(connstr string, o CollectConfig) *sql.DB {
 	db, err := sql.Open("pgx", connstr)
 	if err != nil {
-		log.Fatalf("failed to open connection: %v", err)
+		fatalf(o.Context, "failed to open connection: %v", err)
 	}
 
 	// ensure only 1 conn
@@ -281,13 +409,13 @@ func getConn(connstr string, o CollectConfig) *sql.DB {
 	// set role, if specified
 	if len(o.Role) > 0 {
 		if !isValidIdent(o.Role) {
-			log.Fatalf("bad format for role %q", o.Role)
+			fatalf(o.Context, "bad format for role %q", o.Role)
 		}
 		t := time.Duration(o.TimeoutSec) * time.Second
-		ctx, cancel := context.WithTimeout(context.Background(), t)
+		ctx, cancel := context.WithTimeout(o.Context, t)
 		defer cancel()
 		if _, err := db.ExecContext(ctx, "SET ROLE "+o.Role); err != nil {
-			log.Fatalf("failed to set role %q: %v", o.Role, err)
+			fatalf(o.Context, "failed to set role %q: %v", o.Role, err)
 		}
 	}
 
@@ -296,8 +424,8 @@ func getConn(connstr string, o CollectConfig) *sql.DB {
 
 func collectFromDB(connstr string, c *collector, o CollectConfig) {
 	db := getConn(connstr, o)
+	defer db.Close()
 	c.collect(db, o)
-	db.Close()
 }
 
 func getDBNames(connstr string, o CollectConfig) (dbnames []string) {
@@ -305,7 +433,7 @@ func getDBNames(connstr string, o CollectConfig) (dbnames []string) {
 	defer db.Close()
 
 	timeout := time.Duration(o.TimeoutSec) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(o.Context, timeout)
 	defer cancel()
 
 	q := `SELECT datname
@@ -313,44 +441,51 @@ func getDBNames(connstr string, o CollectConfig) (dbnames []string) {
 		   WHERE (NOT datistemplate) AND (datname <> 'postgres')`
 	rows, err := db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_database query failed: %v", err)
+		fatalf(o.Context, "pg_database query failed: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			log.Fatalf("pg_database query failed: %v", err)
+			fatalf(o.Context, "pg_database query failed: %v", err)
 		}
 		dbnames = append(dbnames, name)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_database query failed: %v", err)
+		fatalf(o.Context, "pg_database query failed: %v", err)
 	}
 	return
 }
 
 type collector struct {
-	db           *sql.DB
-	result       pgmetrics.Model
-	version      int    // integer form of server version
-	local        bool   // have we connected to the server on the same machine?
-	dataDir      string // the PGDATA dir, valid only if local
-	beenHere     bool
-	timeout      time.Duration
-	rxSchema     *regexp.Regexp
-	rxExclSchema *regexp.Regexp
-	rxTable      *regexp.Regexp
-	rxExclTable  *regexp.Regexp
-	sqlLength    uint
-	stmtsLimit   uint
-	dbnames      []string
-	curlogfile   string
-	csvlog       bool
-	logSpan      uint
-	currLog      pgmetrics.LogEntry
-	rxPrefix     *regexp.Regexp
-	mode         string // "postgres", "pgbouncer" or "pgpool"
+	ctx           context.Context // parent of all contexts used during collection
+	db            *sql.DB
+	result        pgmetrics.Model
+	version       int    // integer form of server version
+	local         bool   // have we connected to the server on the same machine?
+	dataDir       string // the PGDATA dir, valid only if local
+	beenHere      bool
+	timeout       time.Duration
+	rxSchema      *regexp.Regexp
+	rxExclSchema  *regexp.Regexp
+	rxTable       *regexp.Regexp
+	rxExclTable   *regexp.Regexp
+	sqlLength     uint
+	stmtsLimit    uint
+	dbnames       []string
+	curlogfile    string
+	csvlog        bool
+	logSpan       uint
+	currLog       pgmetrics.LogEntry
+	rxPrefix      *regexp.Regexp
+	mode          string                     // "postgres", "pgbouncer" or "pgpool"
+	stream        *json.Encoder              // non-nil in streaming mode
+	streamErr     error                      // first error writing to stream, stops further writes
+	streamed      map[string]json.RawMessage // top-level fields already written to stream
+	postmasterPID int                        // pid of the postmaster, valid only if local and known
+	procRoot      string                     // prefix for files in /proc, see CollectConfig.ProcRoot
+	sysRoot       string                     // prefix for files in /sys, see CollectConfig.SysRoot
 }
 
 func (c *collector) collect(db *sql.DB, o CollectConfig) {
@@ -365,6 +500,8 @@ func (c *collector) collect(db *sql.DB, o CollectConfig) {
 func (c *collector) collectFirst(db *sql.DB, o CollectConfig) {
 	c.db = db
 	c.timeout = time.Duration(o.TimeoutSec) * time.Second
+	c.procRoot = o.ProcRoot
+	c.sysRoot = o.SysRoot
 
 	// Compile regexes for schema and table, if any. The values are already
 	// checked for validity.
@@ -394,7 +531,7 @@ func (c *collector) collectFirst(db *sql.DB, o CollectConfig) {
 		c.getCurrentUser()
 		c.collectPostgres(o)
 	default:
-		log.Fatalf("unknown mode %q", c.mode)
+		c.fatalf("unknown mode %q", c.mode)
 	}
 }
 
@@ -402,7 +539,7 @@ func (c *collector) collectPostgres(o CollectConfig) {
 	// get settings and other configuration
 	c.getSettings()
 	if v, err := strconv.Atoi(c.setting("server_version_num")); err != nil {
-		log.Fatalf("bad server_version_num: %v", err)
+		c.fatalf("bad server_version_num: %v", err)
 	} else {
 		c.version = v
 	}
@@ -415,18 +552,25 @@ func (c *collector) collectPostgres(o CollectConfig) {
 	}
 
 	c.collectCluster(o)
-	if c.local {
-		// Only implemented for Linux for now.
-		if runtime.GOOS == "linux" {
-			c.collectSystem(o)
+	c.writeClusterSection()
+	if c.local && c.ctx.Err() == nil {
+		// Only partly implemented, or not at all, for non-Linux platforms.
+		c.collectSystem(o)
+		c.checkWALDiskPressure()
+		if c.result.System != nil {
+			c.writeSystemSection()
 		}
 	}
-	c.collectDatabase(o)
+	if c.ctx.Err() == nil {
+		c.collectDatabase(o)
+	}
 }
 
 func (c *collector) collectNext(db *sql.DB, o CollectConfig) {
 	c.db = db
-	c.collectDatabase(o)
+	if c.ctx.Err() == nil {
+		c.collectDatabase(o)
+	}
 }
 
 // cluster-level info and stats
@@ -556,6 +700,13 @@ func (c *collector) collectDatabase(o CollectConfig) {
 	}
 	c.result.Metadata.CollectedDBs = append(c.result.Metadata.CollectedDBs, currdb)
 
+	// Tables and indexes are collected first, along with the other things
+	// that refer to them, so that in streaming mode they can be written out
+	// and dropped before the rest is collected. Citus needs the extensions and
+	// updates the sizes of the tables.
+	if !arrayHas(o.Omit, "extensions") {
+		c.getExtensions()
+	}
 	if !arrayHas(o.Omit, "tables") {
 		c.getTables(!o.NoSizes)
 		// partition information, added schema v1.2
@@ -571,37 +722,43 @@ func (c *collector) collectDatabase(o CollectConfig) {
 			c.getIndexDef()
 		}
 	}
+	if !arrayHas(o.Omit, "tables") && !arrayHas(o.Omit, "triggers") {
+		c.getDisabledTriggers()
+	}
+	if !arrayHas(o.Omit, "bloat") {
+		c.getBloat()
+	}
+	// citus, added in schema 1.9
+	if !arrayHas(o.Omit, "citus") {
+		c.getCitus(currdb, !o.NoSizes)
+	}
+	flushList(c, "tables", currdb, &c.result.Tables)
+	flushList(c, "indexes", currdb, &c.result.Indexes)
+	flushList(c, "disabled_triggers", currdb, &c.result.DisabledTriggers)
+	flushList(c, "extensions", currdb, &c.result.Extensions)
+
 	if !arrayHas(o.Omit, "sequences") {
 		c.getSequences()
+		flushList(c, "sequences", currdb, &c.result.Sequences)
 	}
 	if !arrayHas(o.Omit, "functions") {
 		c.getUserFunctions()
-	}
-	if !arrayHas(o.Omit, "extensions") {
-		c.getExtensions()
-	}
-	if !arrayHas(o.Omit, "tables") && !arrayHas(o.Omit, "triggers") {
-		c.getDisabledTriggers()
+		flushList(c, "user_functions", currdb, &c.result.UserFunctions)
 	}
 	if !arrayHas(o.Omit, "statements") {
 		c.getStatements(currdb)
 	}
 	if !arrayHas(o.Omit, "hints") {
 		c.getHints()
-	}
-	if !arrayHas(o.Omit, "bloat") {
-		c.getBloat()
+		flushList(c, "hints", currdb, &c.result.Hints)
 	}
 
 	// logical replication, added schema v1.2
 	if c.version >= pgv10 {
 		c.getPublications()
 		c.getSubscriptions()
-	}
-
-	// citus, added in schema 1.9
-	if !arrayHas(o.Omit, "citus") {
-		c.getCitus(currdb, !o.NoSizes)
+		flushList(c, "publications", currdb, &c.result.Publications)
+		flushList(c, "subscriptions", currdb, &c.result.Subscriptions)
 	}
 }
 
@@ -660,12 +817,12 @@ func (c *collector) tableOK(schema, table string) bool {
 }
 
 func (c *collector) getCurrentUser() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT current_user`
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.Metadata.Username); err != nil {
-		log.Fatalf("current_user failed: %v", err)
+		c.fatalf("current_user failed: %v", err)
 	}
 }
 
@@ -677,7 +834,7 @@ func (c *collector) setting(key string) string {
 }
 
 func (c *collector) getSettings() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT name, setting, COALESCE(boot_val,''), source,
@@ -691,7 +848,7 @@ func (c *collector) getSettings() {
 
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_settings query failed: %v", err)
+		c.fatalf("pg_settings query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -700,7 +857,7 @@ func (c *collector) getSettings() {
 		var s pgmetrics.Setting
 		var name, sf, sl string
 		if err := rows.Scan(&name, &s.Setting, &s.BootVal, &s.Source, &sf, &sl, &s.Pending); err != nil {
-			log.Fatalf("pg_settings query failed: %v", err)
+			c.fatalf("pg_settings query failed: %v", err)
 		}
 		if len(sf) > 0 {
 			s.Source = sf
@@ -715,12 +872,12 @@ func (c *collector) getSettings() {
 		c.result.Settings[name] = s
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_settings query failed: %v", err)
+		c.fatalf("pg_settings query failed: %v", err)
 	}
 }
 
 func (c *collector) getWALArchiver() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT archived_count, 
@@ -735,13 +892,13 @@ func (c *collector) getWALArchiver() {
 	if err := c.db.QueryRowContext(ctx, q).Scan(&a.ArchivedCount, &a.LastArchivedWAL,
 		&a.LastArchivedTime, &a.FailedCount, &a.LastFailedWAL, &a.LastFailedTime,
 		&a.StatsReset); err != nil {
-		log.Fatalf("pg_stat_archiver query failed: %v", err)
+		c.fatalf("pg_stat_archiver query failed: %v", err)
 	}
 }
 
 // have we connected to a postgres server running on the local machine?
 func (c *collector) getLocal() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// see also https://github.com/rapidloop/pgmetrics/issues/39
@@ -754,7 +911,7 @@ func (c *collector) getLocal() {
 }
 
 func (c *collector) getBGWriterv17() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT buffers_clean, maxwritten_clean, buffers_alloc, stats_reset
@@ -763,14 +920,14 @@ func (c *collector) getBGWriterv17() {
 	var statsReset time.Time
 	if err := c.db.QueryRowContext(ctx, q).Scan(&bg.BuffersClean,
 		&bg.MaxWrittenClean, &bg.BuffersAlloc, &statsReset); err != nil {
-		log.Fatalf("pg_stat_bgwriter query failed: %v", err)
+		c.fatalf("pg_stat_bgwriter query failed: %v", err)
 		return
 	}
 	bg.StatsReset = statsReset.Unix()
 }
 
 func (c *collector) getBGWriter() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT checkpoints_timed, checkpoints_req, checkpoint_write_time,
@@ -783,14 +940,14 @@ func (c *collector) getBGWriter() {
 		&bg.CheckpointWriteTime, &bg.CheckpointSyncTime, &bg.BuffersCheckpoint,
 		&bg.BuffersClean, &bg.MaxWrittenClean, &bg.BuffersBackend,
 		&bg.BuffersBackendFsync, &bg.BuffersAlloc, &statsReset); err != nil {
-		log.Fatalf("pg_stat_bgwriter query failed: %v", err)
+		c.fatalf("pg_stat_bgwriter query failed: %v", err)
 		return
 	}
 	bg.StatsReset = statsReset.Unix()
 }
 
 func (c *collector) getReplicationv10() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(usename, ''), application_name,
@@ -830,18 +987,18 @@ func (c *collector) getReplicationv10() {
 			&r.BackendStart, &backendXmin, &r.State, &r.SentLSN, &r.WriteLSN,
 			&r.FlushLSN, &r.ReplayLSN, &r.WriteLag, &r.FlushLag, &r.ReplayLag,
 			&r.SyncPriority, &r.SyncState, &r.ReplyTime, &r.PID); err != nil {
-			log.Fatalf("pg_stat_replication query failed: %v", err)
+			c.fatalf("pg_stat_replication query failed: %v", err)
 		}
 		r.BackendXmin = int(backendXmin.Int64)
 		c.result.ReplicationOutgoing = append(c.result.ReplicationOutgoing, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_replication query failed: %v", err)
+		c.fatalf("pg_stat_replication query failed: %v", err)
 	}
 }
 
 func (c *collector) getReplicationv9() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(usename, ''), application_name,
@@ -873,13 +1030,13 @@ func (c *collector) getReplicationv9() {
 		if err := rows.Scan(&r.RoleName, &r.ApplicationName, &r.ClientAddr,
 			&r.BackendStart, &backendXmin, &r.State, &r.SentLSN, &r.WriteLSN,
 			&r.FlushLSN, &r.ReplayLSN, &r.SyncPriority, &r.SyncState, &r.PID); err != nil {
-			log.Fatalf("pg_stat_replication query failed: %v", err)
+			c.fatalf("pg_stat_replication query failed: %v", err)
 		}
 		r.BackendXmin = int(backendXmin.Int64)
 		c.result.ReplicationOutgoing = append(c.result.ReplicationOutgoing, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_replication query failed: %v", err)
+		c.fatalf("pg_stat_replication query failed: %v", err)
 	}
 }
 
@@ -890,7 +1047,7 @@ func (c *collector) getWalReceiverv13() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT status, receive_start_lsn, receive_start_tli,
@@ -937,7 +1094,7 @@ func (c *collector) getWalReceiverv96() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT status, receive_start_lsn, receive_start_tli, received_lsn, 
@@ -971,7 +1128,7 @@ func (c *collector) getWalReceiverv96() {
 }
 
 func (c *collector) getAdminFuncv9() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pg_is_in_recovery(),
@@ -992,7 +1149,7 @@ func (c *collector) getAdminFuncv9() {
 		if !c.isAWSAurora() {
 			qr := `SELECT pg_is_xlog_replay_paused()`
 			if err := c.db.QueryRowContext(ctx, qr).Scan(&c.result.IsWalReplayPaused); err != nil {
-				log.Fatalf("pg_is_xlog_replay_paused() failed: %v", err)
+				c.fatalf("pg_is_xlog_replay_paused() failed: %v", err)
 			}
 		}
 	} else {
@@ -1001,7 +1158,7 @@ func (c *collector) getAdminFuncv9() {
 					pg_current_xlog_insert_location(), pg_current_xlog_location()`
 			if err := c.db.QueryRowContext(ctx, qx).Scan(&c.result.WALFlushLSN,
 				&c.result.WALInsertLSN, &c.result.WALLSN); err != nil {
-				log.Fatalf("error querying wal location functions: %v", err)
+				c.fatalf("error querying wal location functions: %v", err)
 			}
 		}
 		// pg_current_xlog_* not available in < v9.6
@@ -1009,7 +1166,7 @@ func (c *collector) getAdminFuncv9() {
 }
 
 func (c *collector) getAdminFuncv10() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pg_is_in_recovery(),
@@ -1030,7 +1187,7 @@ func (c *collector) getAdminFuncv10() {
 		if !c.isAWSAurora() {
 			qr := `SELECT pg_is_wal_replay_paused()`
 			if err := c.db.QueryRowContext(ctx, qr).Scan(&c.result.IsWalReplayPaused); err != nil {
-				log.Fatalf("pg_is_wal_replay_paused() failed: %v", err)
+				c.fatalf("pg_is_wal_replay_paused() failed: %v", err)
 			}
 		}
 	} else {
@@ -1039,14 +1196,14 @@ func (c *collector) getAdminFuncv10() {
 				pg_current_wal_insert_lsn(), pg_current_wal_lsn()`
 			if err := c.db.QueryRowContext(ctx, qx).Scan(&c.result.WALFlushLSN,
 				&c.result.WALInsertLSN, &c.result.WALLSN); err != nil {
-				log.Fatalf("error querying wal location functions: %v", err)
+				c.fatalf("error querying wal location functions: %v", err)
 			}
 		}
 	}
 }
 
 func (c *collector) fillTablespaceSize(t *pgmetrics.Tablespace) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pg_tablespace_size($1)`
@@ -1056,7 +1213,7 @@ func (c *collector) fillTablespaceSize(t *pgmetrics.Tablespace) {
 }
 
 func (c *collector) fillDatabaseSize(d *pgmetrics.Database) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pg_database_size($1)`
@@ -1071,7 +1228,7 @@ func (c *collector) getLastXactv95() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT xid, COALESCE(EXTRACT(EPOCH FROM timestamp)::bigint, 0)
@@ -1082,7 +1239,7 @@ func (c *collector) getLastXactv95() {
 }
 
 func (c *collector) getPGSystemInfo() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT
@@ -1096,22 +1253,22 @@ func (c *collector) getPGSystemInfo() {
 		&c.result.StartTime,
 		&c.result.ConfLoadTime,
 		&c.result.ConnectionTuple); err != nil {
-		log.Fatalf("system functions query failed: %v", err)
+		c.fatalf("system functions query failed: %v", err)
 	}
 }
 
 func (c *collector) getControlSystemv96() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT system_identifier FROM pg_control_system()`
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.SystemIdentifier); err != nil {
-		log.Fatalf("pg_control_system() failed: %v", err)
+		c.fatalf("pg_control_system() failed: %v", err)
 	}
 }
 
 func (c *collector) getControlCheckpointv96() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT checkpoint_location, prior_location, redo_location, timeline_id,
@@ -1123,14 +1280,14 @@ func (c *collector) getControlCheckpointv96() {
 		&c.result.PriorLSN, &c.result.RedoLSN, &c.result.TimelineID, &nextXid,
 		&c.result.OldestXid, &c.result.OldestActiveXid,
 		&c.result.CheckpointTime); err != nil {
-		log.Fatalf("pg_control_checkpoint() failed: %v", err)
+		c.fatalf("pg_control_checkpoint() failed: %v", err)
 	}
 
 	if pos := strings.IndexByte(nextXid, ':'); pos > -1 {
 		nextXid = nextXid[pos+1:]
 	}
 	if v, err := strconv.Atoi(nextXid); err != nil {
-		log.Fatal("bad xid in pg_control_checkpoint()).next_xid")
+		c.fatalf("bad xid in pg_control_checkpoint()).next_xid")
 	} else {
 		c.result.NextXid = v
 	}
@@ -1139,7 +1296,7 @@ func (c *collector) getControlCheckpointv96() {
 }
 
 func (c *collector) getControlCheckpointv10() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT checkpoint_lsn, prior_lsn, redo_lsn, timeline_id,
@@ -1150,14 +1307,14 @@ func (c *collector) getControlCheckpointv10() {
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.CheckpointLSN, &c.result.PriorLSN,
 		&c.result.RedoLSN, &c.result.TimelineID, &nextXid, &c.result.OldestXid,
 		&c.result.OldestActiveXid, &c.result.CheckpointTime); err != nil {
-		log.Fatalf("pg_control_checkpoint() failed: %v", err)
+		c.fatalf("pg_control_checkpoint() failed: %v", err)
 	}
 
 	if pos := strings.IndexByte(nextXid, ':'); pos > -1 {
 		nextXid = nextXid[pos+1:]
 	}
 	if v, err := strconv.Atoi(nextXid); err != nil {
-		log.Fatal("bad xid in pg_control_checkpoint()).next_xid")
+		c.fatalf("bad xid in pg_control_checkpoint()).next_xid")
 	} else {
 		c.result.NextXid = v
 	}
@@ -1166,7 +1323,7 @@ func (c *collector) getControlCheckpointv10() {
 }
 
 func (c *collector) getControlCheckpointv11() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT checkpoint_lsn, redo_lsn, timeline_id,
@@ -1177,14 +1334,14 @@ func (c *collector) getControlCheckpointv11() {
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.CheckpointLSN,
 		&c.result.RedoLSN, &c.result.TimelineID, &nextXid, &c.result.OldestXid,
 		&c.result.OldestActiveXid, &c.result.CheckpointTime); err != nil {
-		log.Fatalf("pg_control_checkpoint() failed: %v", err)
+		c.fatalf("pg_control_checkpoint() failed: %v", err)
 	}
 
 	if pos := strings.IndexByte(nextXid, ':'); pos > -1 {
 		nextXid = nextXid[pos+1:]
 	}
 	if v, err := strconv.Atoi(nextXid); err != nil {
-		log.Fatal("bad xid in pg_control_checkpoint()).next_xid")
+		c.fatalf("bad xid in pg_control_checkpoint()).next_xid")
 	} else {
 		c.result.NextXid = v
 	}
@@ -1203,7 +1360,7 @@ func (c *collector) fixAuroraCheckpoint() {
 }
 
 func (c *collector) getActivityv96() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(datname, ''), COALESCE(usename, ''),
@@ -1229,7 +1386,7 @@ func (c *collector) getActivityv96() {
 	q += " ORDER BY pid ASC"
 	rows, err := c.db.QueryContext(ctx, q, c.sqlLength)
 	if err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1240,19 +1397,19 @@ func (c *collector) getActivityv96() {
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
 			&b.StateChange, &b.WaitEventType, &b.WaitEvent, &b.State,
 			&backendXid, &backendXmin, &b.Query, &b.QueryID); err != nil {
-			log.Fatalf("pg_stat_activity query failed: %v", err)
+			c.fatalf("pg_stat_activity query failed: %v", err)
 		}
 		b.BackendXid, _ = strconv.Atoi(backendXid)
 		b.BackendXmin, _ = strconv.Atoi(backendXmin)
 		c.result.Backends = append(c.result.Backends, b)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 }
 
 func (c *collector) getActivityv94() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(datname, ''), COALESCE(usename, ''),
@@ -1269,7 +1426,7 @@ func (c *collector) getActivityv94() {
 		  ORDER BY pid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1280,7 +1437,7 @@ func (c *collector) getActivityv94() {
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
 			&b.StateChange, &waiting, &b.State,
 			&b.BackendXid, &b.BackendXmin, &b.Query); err != nil {
-			log.Fatalf("pg_stat_activity query failed: %v", err)
+			c.fatalf("pg_stat_activity query failed: %v", err)
 		}
 		if waiting {
 			b.WaitEvent = "waiting"
@@ -1289,12 +1446,12 @@ func (c *collector) getActivityv94() {
 		c.result.Backends = append(c.result.Backends, b)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 }
 
 func (c *collector) getActivityv93() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT COALESCE(datname, ''), COALESCE(usename, ''),
@@ -1310,7 +1467,7 @@ func (c *collector) getActivityv93() {
 		  ORDER BY pid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1320,7 +1477,7 @@ func (c *collector) getActivityv93() {
 		if err := rows.Scan(&b.DBName, &b.RoleName, &b.ApplicationName,
 			&b.PID, &b.ClientAddr, &b.BackendStart, &b.XactStart, &b.QueryStart,
 			&b.StateChange, &waiting, &b.State, &b.Query); err != nil {
-			log.Fatalf("pg_stat_activity query failed: %v", err)
+			c.fatalf("pg_stat_activity query failed: %v", err)
 		}
 		if waiting {
 			b.WaitEvent = "waiting"
@@ -1329,18 +1486,18 @@ func (c *collector) getActivityv93() {
 		c.result.Backends = append(c.result.Backends, b)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 }
 
 func (c *collector) getBETypeCountsv10() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT backend_type, count(*) FROM pg_stat_activity GROUP BY backend_type`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1349,12 +1506,12 @@ func (c *collector) getBETypeCountsv10() {
 		var bt sql.NullString
 		var count int
 		if err := rows.Scan(&bt, &count); err != nil {
-			log.Fatalf("pg_stat_activity query failed: %v", err)
+			c.fatalf("pg_stat_activity query failed: %v", err)
 		}
 		m[bt.String] = count
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_activity query failed: %v", err)
+		c.fatalf("pg_stat_activity query failed: %v", err)
 	}
 
 	if len(m) > 0 {
@@ -1369,7 +1526,7 @@ func (c *collector) getBETypeCountsv10() {
 //
 //	the name of the currently connected database
 func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// query template
@@ -1429,7 +1586,7 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 	// do the query
 	rows, err := c.db.QueryContext(ctx, q, args...)
 	if err != nil {
-		log.Fatalf("pg_stat_database query failed: %v", err)
+		c.fatalf("pg_stat_database query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1446,13 +1603,13 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 			&d.IdleInTxTime, &d.Sessions, &d.SessionsAbandoned,
 			&d.SessionsFatal, &d.SessionsKilled, &d.ParallelWorkersToLaunch,
 			&d.ParallelWorkersLaunched); err != nil {
-			log.Fatalf("pg_stat_database query failed: %v", err)
+			c.fatalf("pg_stat_database query failed: %v", err)
 		}
 		d.Size = -1 // will be filled in later if asked for
 		c.result.Databases = append(c.result.Databases, d)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_database query failed: %v", err)
+		c.fatalf("pg_stat_database query failed: %v", err)
 	}
 
 	// fill in the size if asked for
@@ -1465,7 +1622,7 @@ func (c *collector) getDatabases(fillSize, onlyListed bool, dbList []string) {
 }
 
 func (c *collector) getTablespaces(fillSize bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT oid, spcname, pg_get_userbyid(spcowner),
@@ -1474,14 +1631,14 @@ func (c *collector) getTablespaces(fillSize bool) {
 		  ORDER BY oid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_tablespace query failed: %v", err)
+		c.fatalf("pg_tablespace query failed: %v", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var t pgmetrics.Tablespace
 		if err := rows.Scan(&t.OID, &t.Name, &t.Owner, &t.Location); err != nil {
-			log.Fatalf("pg_tablespace query failed: %v", err)
+			c.fatalf("pg_tablespace query failed: %v", err)
 		}
 		t.Size = -1 // will be filled in later if asked for
 		if (t.Name == "pg_default" || t.Name == "pg_global") && t.Location == "" {
@@ -1490,7 +1647,7 @@ func (c *collector) getTablespaces(fillSize bool) {
 		c.result.Tablespaces = append(c.result.Tablespaces, t)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_tablespace query failed: %v", err)
+		c.fatalf("pg_tablespace query failed: %v", err)
 	}
 
 	if !fillSize {
@@ -1502,12 +1659,12 @@ func (c *collector) getTablespaces(fillSize bool) {
 }
 
 func (c *collector) getCurrentDatabase() (dbname string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT current_database()`
 	if err := c.db.QueryRowContext(ctx, q).Scan(&dbname); err != nil {
-		log.Fatalf("current_database failed: %v", err)
+		c.fatalf("current_database failed: %v", err)
 	}
 	return
 }
@@ -1525,12 +1682,12 @@ func (c *collector) getTables(fillSize bool) {
 	}
 
 	if err != nil {
-		log.Fatalf("pg_stat(io)_user_tables query failed: %v", err)
+		c.fatalf("pg_stat(io)_user_tables query failed: %v", err)
 	}
 }
 
 func (c *collector) getTablesNoRetry(fillSize bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT S.relid, S.schemaname, S.relname, current_database(),
@@ -1645,12 +1802,12 @@ func (c *collector) getIndexes(fillSize bool) {
 	}
 
 	if err != nil {
-		log.Fatalf("pg_stat_user_indexes query failed: %v", err)
+		c.fatalf("pg_stat_user_indexes query failed: %v", err)
 	}
 }
 
 func (c *collector) getIndexesNoRetry(fillSize bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT S.relid, S.indexrelid, S.schemaname, S.relname, S.indexrelname,
@@ -1708,7 +1865,7 @@ func (c *collector) getIndexesNoRetry(fillSize bool) error {
 // silently fail the collection of just the index defs, and let the collection
 // of index stats succeed.
 func (c *collector) getIndexDef() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT indexrelid, pg_get_indexdef(indexrelid) FROM pg_stat_user_indexes`
@@ -1735,7 +1892,7 @@ func (c *collector) getIndexDef() {
 }
 
 func (c *collector) getSequences() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT relid, schemaname, relname, current_database(), blks_read,
@@ -1744,7 +1901,7 @@ func (c *collector) getSequences() {
 		  ORDER BY relid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_statio_user_sequences query failed: %v", err)
+		c.fatalf("pg_statio_user_sequences query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1752,19 +1909,19 @@ func (c *collector) getSequences() {
 		var s pgmetrics.Sequence
 		if err := rows.Scan(&s.OID, &s.SchemaName, &s.Name, &s.DBName,
 			&s.BlksRead, &s.BlksHit); err != nil {
-			log.Fatalf("pg_statio_user_sequences query failed: %v", err)
+			c.fatalf("pg_statio_user_sequences query failed: %v", err)
 		}
 		if c.schemaOK(s.SchemaName) {
 			c.result.Sequences = append(c.result.Sequences, s)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_statio_user_sequences query failed: %v", err)
+		c.fatalf("pg_statio_user_sequences query failed: %v", err)
 	}
 }
 
 func (c *collector) getUserFunctions() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT funcid, schemaname, funcname, current_database(), calls,
@@ -1773,7 +1930,7 @@ func (c *collector) getUserFunctions() {
 		  ORDER BY funcid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_user_functions query failed: %v", err)
+		c.fatalf("pg_stat_user_functions query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1781,19 +1938,19 @@ func (c *collector) getUserFunctions() {
 		var f pgmetrics.UserFunction
 		if err := rows.Scan(&f.OID, &f.SchemaName, &f.Name, &f.DBName,
 			&f.Calls, &f.TotalTime, &f.SelfTime); err != nil {
-			log.Fatalf("pg_stat_user_functions query failed: %v", err)
+			c.fatalf("pg_stat_user_functions query failed: %v", err)
 		}
 		if c.schemaOK(f.SchemaName) {
 			c.result.UserFunctions = append(c.result.UserFunctions, f)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_user_functions query failed: %v", err)
+		c.fatalf("pg_stat_user_functions query failed: %v", err)
 	}
 }
 
 func (c *collector) getVacuumProgressv17() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, COALESCE(relid, 0), COALESCE(phase, ''),
@@ -1812,7 +1969,7 @@ func (c *collector) getVacuumProgressv17() {
 
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+		c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1822,7 +1979,7 @@ func (c *collector) getVacuumProgressv17() {
 			&p.HeapBlksScanned, &p.HeapBlksVacuumed, &p.IndexVacuumCount,
 			&p.MaxDeadTupleBytes, &p.DeadTupleBytes, &p.NumDeadItemIDs,
 			&p.IndexesTotal, &p.IndexesProcessed, &p.DelayTime); err != nil {
-			log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+			c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 		}
 		if t := c.result.TableByOID(p.TableOID); t != nil {
 			p.TableName = t.Name
@@ -1830,12 +1987,12 @@ func (c *collector) getVacuumProgressv17() {
 		c.result.VacuumProgress = append(c.result.VacuumProgress, p)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+		c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
 }
 
 func (c *collector) getVacuumProgressv96() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, COALESCE(relid, 0), COALESCE(phase, ''),
@@ -1846,7 +2003,7 @@ func (c *collector) getVacuumProgressv96() {
 		  ORDER BY pid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+		c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1855,7 +2012,7 @@ func (c *collector) getVacuumProgressv96() {
 		if err := rows.Scan(&p.PID, &p.DBName, &p.TableOID, &p.Phase, &p.HeapBlksTotal,
 			&p.HeapBlksScanned, &p.HeapBlksVacuumed, &p.IndexVacuumCount,
 			&p.MaxDeadTuples, &p.NumDeadTuples); err != nil {
-			log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+			c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 		}
 		if t := c.result.TableByOID(p.TableOID); t != nil {
 			p.TableName = t.Name
@@ -1863,12 +2020,12 @@ func (c *collector) getVacuumProgressv96() {
 		c.result.VacuumProgress = append(c.result.VacuumProgress, p)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_vacuum query failed: %v", err)
+		c.fatalf("pg_stat_progress_vacuum query failed: %v", err)
 	}
 }
 
 func (c *collector) getExtensions() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT e.name AS name, current_database(),
@@ -1882,7 +2039,7 @@ func (c *collector) getExtensions() {
 		  ORDER BY name ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_available_extensions query failed: %v", err)
+		c.fatalf("pg_available_extensions query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1890,17 +2047,17 @@ func (c *collector) getExtensions() {
 		var e pgmetrics.Extension
 		if err := rows.Scan(&e.Name, &e.DBName, &e.DefaultVersion,
 			&e.InstalledVersion, &e.Comment, &e.SchemaName); err != nil {
-			log.Fatalf("pg_available_extensions query failed: %v", err)
+			c.fatalf("pg_available_extensions query failed: %v", err)
 		}
 		c.result.Extensions = append(c.result.Extensions, e)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_available_extensions query failed: %v", err)
+		c.fatalf("pg_available_extensions query failed: %v", err)
 	}
 }
 
 func (c *collector) getRoles() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT R.oid, R.rolname, R.rolsuper, R.rolinherit, R.rolcreaterole,
@@ -1916,7 +2073,7 @@ func (c *collector) getRoles() {
 	}
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_roles/pg_auth_members query failed: %v", err)
+		c.fatalf("pg_roles/pg_auth_members query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -1928,7 +2085,7 @@ func (c *collector) getRoles() {
 			&r.Rolcreaterole, &r.Rolcreatedb, &r.Rolcanlogin, &r.Rolreplication,
 			&r.Rolbypassrls, &r.Rolconnlimit, &validUntil,
 			m.SQLScanner(&r.MemberOf)); err != nil {
-			log.Fatalf("pg_roles/pg_auth_members query failed: %v", err)
+			c.fatalf("pg_roles/pg_auth_members query failed: %v", err)
 		}
 		if !math.IsInf(validUntil, 0) {
 			r.Rolvaliduntil = int64(validUntil)
@@ -1936,18 +2093,19 @@ func (c *collector) getRoles() {
 		c.result.Roles = append(c.result.Roles, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_roles/pg_auth_members query failed: %v", err)
+		c.fatalf("pg_roles/pg_auth_members query failed: %v", err)
 	}
 }
 
 func (c *collector) getReplicationSlotsv94() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT slot_name, COALESCE(plugin, ''), slot_type,
 			COALESCE(database, ''), active, xmin, catalog_xmin,
 			restart_lsn, confirmed_flush_lsn, temporary,
-			@wal_status@, @safe_wal_size@, two_phase, @conflicting@
+			@wal_status@, @safe_wal_size@, two_phase, @conflicting@,
+			@retained@
 		  FROM pg_replication_slots
 		  ORDER BY slot_name ASC`
 	if c.version < pgv96 { // confirmed_flush_lsn only in pg >= 9.6
@@ -1971,6 +2129,23 @@ func (c *collector) getReplicationSlotsv94() {
 	} else {
 		q = strings.Replace(q, "@conflicting@", `COALESCE(conflicting, FALSE)`, 1)
 	}
+	// WAL retained is from restart_lsn up to the current WAL location, or on
+	// a standby, up to the last WAL received (or replayed, if not streaming)
+	lsn, diff := `pg_current_wal_lsn()`, `pg_wal_lsn_diff`
+	if c.result.IsInRecovery {
+		lsn = `COALESCE(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn())`
+	}
+	if c.version < pgv10 { // xlog instead of wal in function names before pg10
+		lsn = strings.NewReplacer("_wal_lsn", "_xlog_location",
+			"_wal_receive_lsn", "_xlog_receive_location",
+			"_wal_replay_lsn", "_xlog_replay_location").Replace(lsn)
+		diff = `pg_xlog_location_diff`
+	}
+	retained := `GREATEST(COALESCE(` + diff + `(` + lsn + `, restart_lsn), 0), 0)::bigint`
+	if c.isAWSAurora() { // WAL location functions are not usable on Aurora
+		retained = `0::bigint`
+	}
+	q = strings.Replace(q, "@retained@", retained, 1)
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
 		log.Printf("warning: pg_replication_slots query failed: %v", err)
@@ -1985,8 +2160,8 @@ func (c *collector) getReplicationSlotsv94() {
 		if err := rows.Scan(&rs.SlotName, &rs.Plugin, &rs.SlotType,
 			&rs.DBName, &rs.Active, &xmin, &cXmin, &rlsn, &cflsn,
 			&rs.Temporary, &rs.WALStatus, &rs.SafeWALSize, &rs.TwoPhase,
-			&rs.Conflicting); err != nil {
-			log.Fatalf("pg_replication_slots query failed: %v", err)
+			&rs.Conflicting, &rs.RetainedWALBytes); err != nil {
+			c.fatalf("pg_replication_slots query failed: %v", err)
 		}
 		rs.Xmin = int(xmin.Int64)
 		rs.CatalogXmin = int(cXmin.Int64)
@@ -1995,12 +2170,38 @@ func (c *collector) getReplicationSlotsv94() {
 		c.result.ReplicationSlots = append(c.result.ReplicationSlots, rs)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_replication_slots query failed: %v", err)
+		c.fatalf("pg_replication_slots query failed: %v", err)
+	}
+
+	if len(c.result.ReplicationSlots) > 0 {
+		var wr pgmetrics.WALRetention
+		for _, rs := range c.result.ReplicationSlots {
+			wr.TotalRetainedWALBytes += rs.RetainedWALBytes
+		}
+		c.result.WALRetention = &wr
+	}
+}
+
+// walDiskPressureLimit is the fraction of the WAL directory's filesystem
+// which, if exceeded by its used space while replication slots are retaining
+// WAL, sets WALRetention.WALDiskPressure.
+const walDiskPressureLimit = 0.8
+
+// checkWALDiskPressure sets WALRetention.WALDiskPressure, using the WAL
+// directory disk usage collected by collectSystem. The retained WAL is not
+// added to the used space, it is already in the WAL directory and counted in
+// it.
+func (c *collector) checkWALDiskPressure() {
+	wr, du := c.result.WALRetention, c.result.WALDirDisk
+	if wr == nil || du == nil || du.DiskTotal <= 0 {
+		return
 	}
+	wr.WALDiskPressure = wr.TotalRetainedWALBytes > 0 &&
+		float64(du.DiskUsed) > walDiskPressureLimit*float64(du.DiskTotal)
 }
 
 func (c *collector) getDisabledTriggers() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT T.oid, T.tgrelid, T.tgname, P.proname
@@ -2009,7 +2210,7 @@ func (c *collector) getDisabledTriggers() {
 		  ORDER BY T.oid ASC`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_trigger/pg_proc query failed: %v", err)
+		c.fatalf("pg_trigger/pg_proc query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2017,7 +2218,7 @@ func (c *collector) getDisabledTriggers() {
 		var tg pgmetrics.Trigger
 		var tgrelid int
 		if err := rows.Scan(&tg.OID, &tgrelid, &tg.Name, &tg.ProcName); err != nil {
-			log.Fatalf("pg_trigger/pg_proc query failed: %v", err)
+			c.fatalf("pg_trigger/pg_proc query failed: %v", err)
 		}
 		if t := c.result.TableByOID(tgrelid); t != nil {
 			tg.DBName = t.DBName
@@ -2029,7 +2230,7 @@ func (c *collector) getDisabledTriggers() {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_trigger/pg_proc query failed: %v", err)
+		c.fatalf("pg_trigger/pg_proc query failed: %v", err)
 	}
 }
 
@@ -2072,7 +2273,7 @@ func (c *collector) getStatements(currdb string) {
 }
 
 func (c *collector) getStatementsv112(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls,
@@ -2121,7 +2322,7 @@ func (c *collector) getStatementsv112(schema string) {
 			&s.JITDeformCount, &s.JITDeformTime, &statsSince, &minMaxStatsSince,
 			&s.WALBuffersFull, &s.ParallelWorkersToLaunch, &s.ParallelWorkersLaunched,
 		); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2140,12 +2341,12 @@ func (c *collector) getStatementsv112(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getStatementsv111(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls,
@@ -2192,7 +2393,7 @@ func (c *collector) getStatementsv111(schema string) {
 			&s.JITEmissionTime, &s.LocalBlkReadTime, &s.LocalBlkWriteTime,
 			&s.JITDeformCount, &s.JITDeformTime, &statsSince, &minMaxStatsSince,
 		); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2211,12 +2412,12 @@ func (c *collector) getStatementsv111(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getStatementsv110(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls,
@@ -2258,7 +2459,7 @@ func (c *collector) getStatementsv110(schema string) {
 			&s.JITGenerationTime, &s.JITInliningCount, &s.JITInliningTime,
 			&s.JITOptimizationCount, &s.JITOptimizationTime, &s.JITEmissionCount,
 			&s.JITEmissionTime); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2273,12 +2474,12 @@ func (c *collector) getStatementsv110(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getStatementsv19(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls,
@@ -2313,7 +2514,7 @@ func (c *collector) getStatementsv19(schema string) {
 			&s.TempBlksWritten, &s.BlkReadTime, &s.BlkWriteTime, &s.Plans,
 			&s.TotalPlanTime, &s.MinPlanTime, &s.MaxPlanTime, &s.StddevPlanTime,
 			&s.WALRecords, &s.WALFPI, &s.WALBytes, &s.TopLevel); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2328,12 +2529,12 @@ func (c *collector) getStatementsv19(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getStatementsv18(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls,
@@ -2367,7 +2568,7 @@ func (c *collector) getStatementsv18(schema string) {
 			&s.TempBlksWritten, &s.BlkReadTime, &s.BlkWriteTime, &s.Plans,
 			&s.TotalPlanTime, &s.MinPlanTime, &s.MaxPlanTime, &s.StddevPlanTime,
 			&s.WALRecords, &s.WALFPI, &s.WALBytes); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2382,12 +2583,12 @@ func (c *collector) getStatementsv18(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getStatementsPrev18(schema string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT userid, dbid, queryid, LEFT(COALESCE(query, ''), $1), calls, total_time,
@@ -2433,7 +2634,7 @@ func (c *collector) getStatementsPrev18(schema string) {
 			&s.SharedBlksWritten, &s.LocalBlksHit, &s.LocalBlksRead,
 			&s.LocalBlksDirtied, &s.LocalBlksWritten, &s.TempBlksRead,
 			&s.TempBlksWritten, &s.BlkReadTime, &s.BlkWriteTime); err != nil {
-			log.Fatalf("pg_stat_statements scan failed: %v", err)
+			c.fatalf("pg_stat_statements scan failed: %v", err)
 		}
 		// UserName
 		if r := c.result.RoleByOID(s.UserOID); r != nil {
@@ -2448,12 +2649,12 @@ func (c *collector) getStatementsPrev18(schema string) {
 		c.result.Statements = append(c.result.Statements, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_statements failed: %v", err)
+		c.fatalf("pg_stat_statements failed: %v", err)
 	}
 }
 
 func (c *collector) getHints() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// Check if hint_plan.hints table exists
@@ -2564,7 +2765,7 @@ func (c *collector) getWALCounts() {
 // getWALCountsActual actually executes the given queries to get the WAL file
 // and archive ready counts.
 func (c *collector) getWALCountsActual(q1, q2 string) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// see postgres source include/access/xlog_internal.h
@@ -2611,12 +2812,12 @@ func (c *collector) getWALCountsActual(q1, q2 string) {
 }
 
 func (c *collector) getNotification() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pg_notification_queue_usage()`
 	if err := c.db.QueryRowContext(ctx, q).Scan(&c.result.NotificationQueueUsage); err != nil {
-		log.Fatalf("pg_notification_queue_usage failed: %v", err)
+		c.fatalf("pg_notification_queue_usage failed: %v", err)
 	}
 }
 
@@ -2630,7 +2831,7 @@ func (c *collector) getLocks() {
 }
 
 func (c *collector) getLockRows() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `
@@ -2644,7 +2845,7 @@ SELECT COALESCE(D.datname, ''), L.locktype, L.mode, L.granted,
 	}
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2652,17 +2853,17 @@ SELECT COALESCE(D.datname, ''), L.locktype, L.mode, L.granted,
 		var l pgmetrics.Lock
 		if err := rows.Scan(&l.DBName, &l.LockType, &l.Mode, &l.Granted,
 			&l.PID, &l.RelationOID, &l.WaitStart); err != nil {
-			log.Fatalf("pg_locks query failed: %v", err)
+			c.fatalf("pg_locks query failed: %v", err)
 		}
 		c.result.Locks = append(c.result.Locks, l)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 }
 
 func (c *collector) getBlockers96() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `
@@ -2670,7 +2871,7 @@ WITH P AS (SELECT DISTINCT pid FROM pg_locks WHERE NOT granted)
 SELECT pid, pg_blocking_pids(pid) FROM P`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2680,17 +2881,17 @@ SELECT pid, pg_blocking_pids(pid) FROM P`
 		var pid int
 		var blockers []int
 		if err := rows.Scan(&pid, m.SQLScanner(&blockers)); err != nil {
-			log.Fatalf("pg_locks query failed: %v", err)
+			c.fatalf("pg_locks query failed: %v", err)
 		}
 		c.result.BlockingPIDs[pid] = blockers
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 }
 
 func (c *collector) getBlockers() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// Based on a query from https://wiki.postgresql.org/wiki/Lock_Monitoring
@@ -2712,7 +2913,7 @@ SELECT DISTINCT blocked_locks.pid AS blocked_pid, blocking_locks.pid AS blocking
  WHERE NOT blocked_locks.GRANTED`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2720,17 +2921,17 @@ SELECT DISTINCT blocked_locks.pid AS blocked_pid, blocking_locks.pid AS blocking
 	for rows.Next() {
 		var pid, blocker int
 		if err := rows.Scan(&pid, &blocker); err != nil {
-			log.Fatalf("pg_locks query failed: %v", err)
+			c.fatalf("pg_locks query failed: %v", err)
 		}
 		c.result.BlockingPIDs[pid] = append(c.result.BlockingPIDs[pid], blocker)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_locks query failed: %v", err)
+		c.fatalf("pg_locks query failed: %v", err)
 	}
 }
 
 func (c *collector) getPublications() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `WITH pc AS (SELECT pubname, COUNT(*) AS c FROM pg_publication_tables GROUP BY 1)
@@ -2747,17 +2948,17 @@ func (c *collector) getPublications() {
 		var p pgmetrics.Publication
 		if err := rows.Scan(&p.OID, &p.Name, &p.DBName, &p.AllTables, &p.Insert,
 			&p.Update, &p.Delete, &p.TableCount); err != nil {
-			log.Fatalf("pg_publication/pg_publication_tables query failed: %v", err)
+			c.fatalf("pg_publication/pg_publication_tables query failed: %v", err)
 		}
 		c.result.Publications = append(c.result.Publications, p)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_publication/pg_publication_tables query failed: %v", err)
+		c.fatalf("pg_publication/pg_publication_tables query failed: %v", err)
 	}
 }
 
 func (c *collector) getSubscriptions() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	var q string
@@ -2817,7 +3018,7 @@ func (c *collector) getSubscriptions() {
 		if err := rows.Scan(&s.OID, &s.Name, &s.DBName, &s.Enabled, &s.PubCount,
 			&s.TableCount, &s.WorkerCount, &s.ReceivedLSN, &s.LatestEndLSN,
 			&msgSend, &msgRecv, &s.LatestEndTime, &s.ApplyErrorCount, &s.SyncErrorCount); err != nil {
-			log.Fatalf("pg_subscription query failed: %v", err)
+			c.fatalf("pg_subscription query failed: %v", err)
 		}
 		if msgSend.Valid {
 			s.LastMsgSendTime = msgSend.Time.Unix()
@@ -2831,12 +3032,12 @@ func (c *collector) getSubscriptions() {
 		c.result.Subscriptions = append(c.result.Subscriptions, s)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_subscription query failed: %v", err)
+		c.fatalf("pg_subscription query failed: %v", err)
 	}
 }
 
 func (c *collector) getPartitionInfo() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT c.oid, inhparent::regclass, COALESCE(pg_get_expr(c.relpartbound, inhrelid), '')
@@ -2844,7 +3045,7 @@ func (c *collector) getPartitionInfo() {
 			WHERE c.relispartition`
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_class query failed: %v", err)
+		c.fatalf("pg_class query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2852,7 +3053,7 @@ func (c *collector) getPartitionInfo() {
 		var oid int
 		var parent, pcv string
 		if err := rows.Scan(&oid, &parent, &pcv); err != nil {
-			log.Fatalf("pg_class query failed: %v", err)
+			c.fatalf("pg_class query failed: %v", err)
 		}
 		if t := c.result.TableByOID(oid); t != nil {
 			t.ParentName = parent
@@ -2860,12 +3061,12 @@ func (c *collector) getPartitionInfo() {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_class query failed: %v", err)
+		c.fatalf("pg_class query failed: %v", err)
 	}
 }
 
 func (c *collector) getParentInfo() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT c.oid, i.inhparent::regclass
@@ -2875,7 +3076,7 @@ func (c *collector) getParentInfo() {
 	}
 	rows, err := c.db.QueryContext(ctx, q)
 	if err != nil {
-		log.Fatalf("pg_class/pg_inherits query failed: %v", err)
+		c.fatalf("pg_class/pg_inherits query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2883,24 +3084,24 @@ func (c *collector) getParentInfo() {
 		var oid int
 		var parent string
 		if err := rows.Scan(&oid, &parent); err != nil {
-			log.Fatalf("pg_class/pg_inherits query failed: %v", err)
+			c.fatalf("pg_class/pg_inherits query failed: %v", err)
 		}
 		if t := c.result.TableByOID(oid); t != nil {
 			t.ParentName = parent
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_class/pg_inherits query failed: %v", err)
+		c.fatalf("pg_class/pg_inherits query failed: %v", err)
 	}
 }
 
 func (c *collector) getBloat() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, sqlBloat)
 	if err != nil {
-		log.Fatalf("bloat query failed: %v", err)
+		c.fatalf("bloat query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -2912,7 +3113,7 @@ func (c *collector) getBloat() {
 			&dummy[1], &dummy[2], &dummy[3], &dummy[4], &wastedbytes, &dummy[5],
 			&indexname, &dummy[6], &dummy[7], &dummy[8], &dummy[9], &dummy[10],
 			&wastedibytes, &dummy[11], &dummy[12]); err != nil {
-			log.Fatalf("bloat query failed: %v", err)
+			c.fatalf("bloat query failed: %v", err)
 		}
 		if t := c.result.TableByName(dbname, schemaname, tablename); t != nil && t.Bloat == -1 {
 			t.Bloat = wastedbytes
@@ -2924,7 +3125,7 @@ func (c *collector) getBloat() {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("bloat query failed: %v", err)
+		c.fatalf("bloat query failed: %v", err)
 	}
 }
 
@@ -2935,7 +3136,7 @@ func (c *collector) getWAL() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// pg_stat_wal has only 1 row
@@ -2950,7 +3151,7 @@ func (c *collector) getWAL() {
 		&w.BuffersFull, &w.Write, &w.Sync, &w.WriteTime, &w.SyncTime,
 		&w.StatsReset)
 	if err != nil {
-		log.Fatalf("pg_stat_wal query failed: %v", err)
+		c.fatalf("pg_stat_wal query failed: %v", err)
 	}
 	c.result.WAL = &w
 }
@@ -2962,7 +3163,7 @@ func (c *collector) getWALv18() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// In PostgreSQL 18, wal_write, wal_sync, wal_write_time, wal_sync_time
@@ -2977,13 +3178,13 @@ func (c *collector) getWALv18() {
 	err := c.db.QueryRowContext(ctx, q).Scan(&w.Records, &w.FPI, &w.Bytes,
 		&w.BuffersFull, &w.StatsReset)
 	if err != nil {
-		log.Fatalf("pg_stat_wal query failed: %v", err)
+		c.fatalf("pg_stat_wal query failed: %v", err)
 	}
 	c.result.WAL = &w
 }
 
 func (c *collector) getProgressAnalyze() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, COALESCE(relid::int, 0::int), COALESCE(phase, ''),
@@ -3017,19 +3218,19 @@ func (c *collector) getProgressAnalyze() {
 			&r.SampleBlocksTotal, &r.SampleBlocksScanned, &r.ExtStatsTotal,
 			&r.ExtStatsComputed, &r.ChildTablesTotal, &r.ChildTablesDone,
 			&r.CurrentChildTableRelOID, &r.DelayTime); err != nil {
-			log.Fatalf("pg_stat_progress_analyze query scan failed: %v", err)
+			c.fatalf("pg_stat_progress_analyze query scan failed: %v", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_analyze query rows failed: %v", err)
+		c.fatalf("pg_stat_progress_analyze query rows failed: %v", err)
 	}
 
 	c.result.AnalyzeProgress = out
 }
 
 func (c *collector) getProgressBasebackup() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, COALESCE(phase, ''),
@@ -3052,19 +3253,19 @@ func (c *collector) getProgressBasebackup() {
 		var r pgmetrics.BasebackupProgressBackend
 		if err := rows.Scan(&r.PID, &r.Phase, &r.BackupTotal, &r.BackupStreamed,
 			&r.TablespacesTotal, &r.TablespacesStreamed); err != nil {
-			log.Fatalf("pg_stat_progress_basebackup query scan failed: %v", err)
+			c.fatalf("pg_stat_progress_basebackup query scan failed: %v", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_basebackup query rows failed: %v", err)
+		c.fatalf("pg_stat_progress_basebackup query rows failed: %v", err)
 	}
 
 	c.result.BasebackupProgress = out
 }
 
 func (c *collector) getProgressCluster() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, relid::int, COALESCE(command, ''),
@@ -3091,19 +3292,19 @@ func (c *collector) getProgressCluster() {
 		if err := rows.Scan(&r.PID, &r.DBName, &r.TableOID, &r.Command, &r.Phase,
 			&r.ClusterIndexOID, &r.HeapTuplesScanned, &r.HeapTuplesWritten,
 			&r.HeapBlksTotal, &r.HeapBlksScanned, &r.IndexRebuildCount); err != nil {
-			log.Fatalf("pg_stat_progress_cluster query scan failed: %v", err)
+			c.fatalf("pg_stat_progress_cluster query scan failed: %v", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_cluster query rows failed: %v", err)
+		c.fatalf("pg_stat_progress_cluster query rows failed: %v", err)
 	}
 
 	c.result.ClusterProgress = out
 }
 
 func (c *collector) getProgressCopy() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, relid::int, COALESCE(command, ''),
@@ -3128,19 +3329,19 @@ func (c *collector) getProgressCopy() {
 		if err := rows.Scan(&r.PID, &r.DBName, &r.TableOID, &r.Command, &r.Type,
 			&r.BytesProcessed, &r.BytesTotal, &r.TuplesProcessed,
 			&r.TuplesExcluded); err != nil {
-			log.Fatalf("pg_stat_progress_copy query scan failed: %v", err)
+			c.fatalf("pg_stat_progress_copy query scan failed: %v", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_copy query rows failed: %v", err)
+		c.fatalf("pg_stat_progress_copy query rows failed: %v", err)
 	}
 
 	c.result.CopyProgress = out
 }
 
 func (c *collector) getProgressCreateIndex() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT pid, datname, relid::int, index_relid::int, command, phase,
@@ -3171,19 +3372,19 @@ func (c *collector) getProgressCreateIndex() {
 			&r.CurrentLockerPID, &r.BlocksTotal, &r.BlocksDone,
 			&r.TuplesTotal, &r.TuplesDone, &r.PartitionsTotal,
 			&r.PartitionsDone); err != nil {
-			log.Fatalf("pg_stat_progress_create_index query scan failed: %v", err)
+			c.fatalf("pg_stat_progress_create_index query scan failed: %v", err)
 		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pg_stat_progress_create_index query rows failed: %v", err)
+		c.fatalf("pg_stat_progress_create_index query rows failed: %v", err)
 	}
 
 	c.result.CreateIndexProgress = out
 }
 
 func (c *collector) getCheckpointer() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	q := `SELECT num_timed, num_requested, restartpoints_timed,
@@ -3202,7 +3403,7 @@ func (c *collector) getCheckpointer() {
 		&ckp.WriteTime, &ckp.SyncTime, &ckp.BuffersWritten, &ckp.StatsReset,
 		&ckp.NumDone, &ckp.SLRUWritten)
 	if err != nil {
-		log.Fatalf("pg_stat_checkpointer query failed: %v", err)
+		c.fatalf("pg_stat_checkpointer query failed: %v", err)
 	}
 
 	c.result.Checkpointer = &ckp
@@ -3239,12 +3440,12 @@ func (c *collector) collectPgBouncer() {
  */
 
 func (c *collector) getPBPools() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW POOLS")
 	if err != nil {
-		log.Fatalf("pgbouncer: show pools query failed: %v", err)
+		c.fatalf("pgbouncer: show pools query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -3273,16 +3474,16 @@ func (c *collector) getPBPools() {
 				&pool.SvIdle, &pool.SvUsed, &pool.SvTested, &pool.SvLogin,
 				&pool.MaxWait, &maxWaitUs, &pool.Mode)
 		} else {
-			log.Fatalf("pgbouncer: unsupported number of columns %d in 'SHOW POOLS'", ncols)
+			c.fatalf("pgbouncer: unsupported number of columns %d in 'SHOW POOLS'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgbouncer: show pools query failed: %v", err)
+			c.fatalf("pgbouncer: show pools query failed: %v", err)
 		}
 		pool.MaxWait += maxWaitUs / 1e6
 		c.result.PgBouncer.Pools = append(c.result.PgBouncer.Pools, pool)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgbouncer: show pools query failed: %v", err)
+		c.fatalf("pgbouncer: show pools query failed: %v", err)
 	}
 }
 
@@ -3310,12 +3511,12 @@ func (c *collector) getPBPools() {
  */
 
 func (c *collector) getPBServers() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW SERVERS")
 	if err != nil {
-		log.Fatalf("pgbouncer: show servers query failed: %v", err)
+		c.fatalf("pgbouncer: show servers query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -3348,10 +3549,10 @@ func (c *collector) getPBServers() {
 				&s[7], &s[8], &s[9], &wait, &waitUs, &s[10], &s[11], &s[12],
 				&s[13], &s[14], &s[15], &s[16])
 		} else {
-			log.Fatalf("pgbouncer: unsupported number of columns %d in 'SHOW SERVERS'", ncols)
+			c.fatalf("pgbouncer: unsupported number of columns %d in 'SHOW SERVERS'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgbouncer: show servers query failed: %v", err)
+			c.fatalf("pgbouncer: show servers query failed: %v", err)
 		}
 		wait += waitUs / 1e6 // convert usec -> sec
 		if wait > c.result.PgBouncer.SCMaxWait {
@@ -3367,7 +3568,7 @@ func (c *collector) getPBServers() {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgbouncer: show servers query failed: %v", err)
+		c.fatalf("pgbouncer: show servers query failed: %v", err)
 	}
 }
 
@@ -3395,12 +3596,12 @@ func (c *collector) getPBServers() {
  */
 
 func (c *collector) getPBClients() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW CLIENTS")
 	if err != nil {
-		log.Fatalf("pgbouncer: show clients query failed: %v", err)
+		c.fatalf("pgbouncer: show clients query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -3434,10 +3635,10 @@ func (c *collector) getPBClients() {
 				&s[7], &s[8], &s[9], &wait, &waitUs, &s[10], &s[11], &s[12], &s[13],
 				&s[14], &s[15], &s[16])
 		} else {
-			log.Fatalf("pgbouncer: unsupported number of columns %d in 'SHOW CLIENTS'", ncols)
+			c.fatalf("pgbouncer: unsupported number of columns %d in 'SHOW CLIENTS'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgbouncer: show clients query failed: %v", err)
+			c.fatalf("pgbouncer: show clients query failed: %v", err)
 		}
 		wait += waitUs / 1e6 // convert usec -> sec
 		switch state {
@@ -3456,7 +3657,7 @@ func (c *collector) getPBClients() {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgbouncer: show clients query failed: %v", err)
+		c.fatalf("pgbouncer: show clients query failed: %v", err)
 	}
 	if c.result.PgBouncer.CCWaiting > 0 {
 		c.result.PgBouncer.CCAvgWait = totalWait / float64(c.result.PgBouncer.CCWaiting)
@@ -3485,12 +3686,12 @@ func (c *collector) getPBClients() {
  */
 
 func (c *collector) getPBStats() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW STATS")
 	if err != nil {
-		log.Fatalf("pgbouncer: show stats query failed: %v", err)
+		c.fatalf("pgbouncer: show stats query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -3516,10 +3717,10 @@ func (c *collector) getPBStats() {
 				&stat.AvgQueryCount, &stat.AvgReceived, &stat.AvgSent, &stat.AvgXactTime,
 				&stat.AvgQueryTime, &stat.AvgWaitTime, &stat.AvgServerAssignmentCount)
 		} else {
-			log.Fatalf("pgbouncer: unsupported number of columns %d in 'SHOW STATS'", ncols)
+			c.fatalf("pgbouncer: unsupported number of columns %d in 'SHOW STATS'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgbouncer: show stats query failed: %v", err)
+			c.fatalf("pgbouncer: show stats query failed: %v", err)
 		}
 		// convert usec -> sec
 		stat.TotalXactTime /= 1e6
@@ -3531,7 +3732,7 @@ func (c *collector) getPBStats() {
 		c.result.PgBouncer.Stats = append(c.result.PgBouncer.Stats, stat)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgbouncer: show stats query failed: %v", err)
+		c.fatalf("pgbouncer: show stats query failed: %v", err)
 	}
 }
 
@@ -3555,12 +3756,12 @@ func (c *collector) getPBStats() {
  */
 
 func (c *collector) getPBDatabases() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW DATABASES")
 	if err != nil {
-		log.Fatalf("pgbouncer: show databases query failed: %v", err)
+		c.fatalf("pgbouncer: show databases query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -3587,10 +3788,10 @@ func (c *collector) getPBDatabases() {
 				&user, &s[0], &s[1], &s[2], &s[3], &s[4], &db.MaxConn, &db.CurrConn,
 				&paused, &disabled)
 		} else {
-			log.Fatalf("pgbouncer: unsupported number of columns %d in 'SHOW DATABASES'", ncols)
+			c.fatalf("pgbouncer: unsupported number of columns %d in 'SHOW DATABASES'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgbouncer: show databases query failed: %v", err)
+			c.fatalf("pgbouncer: show databases query failed: %v", err)
 		}
 		db.Host = host.String
 		db.Paused = paused == 1
@@ -3599,7 +3800,7 @@ func (c *collector) getPBDatabases() {
 		c.result.PgBouncer.Databases = append(c.result.PgBouncer.Databases, db)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgbouncer: show databases query failed: %v", err)
+		c.fatalf("pgbouncer: show databases query failed: %v", err)
 	}
 }
 
@@ -3616,7 +3817,7 @@ func (c *collector) getLogInfo() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// format is 'csvlog' or 'stderr'
@@ -3779,7 +3980,7 @@ func (c *collector) collectFromRDS(o CollectConfig) {
 
 func (c *collector) collectFromAzure(o CollectConfig) {
 	timeout := time.Duration(o.TimeoutSec) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(o.Context, timeout)
 	defer cancel()
 
 	var azure pgmetrics.Azure
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingDriver is a database/sql driver whose queries block until their
+// context is done, and then fail.
+type blockingDriver struct{}
+
+func (blockingDriver) Open(string) (driver.Conn, error) { return blockingConn{}, nil }
+
+type blockingConn struct{}
+
+func (blockingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (blockingConn) Close() error                        { return nil }
+func (blockingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	sql.Register("pgmetrics-blocking", blockingDriver{})
+}
+
+func TestCancelDuringQuery(t *testing.T) {
+	db, err := sql.Open("pgmetrics-blocking", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	c := &collector{ctx: ctx, mode: "postgres"}
+	o := DefaultCollectConfig()
+	o.Context = ctx
+	if !catchAbort(func() { c.collect(db, o) }) {
+		t.Fatal("collection was not aborted")
+	}
+	result, err := c.finish()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if result == nil || result.Metadata.Version == "" {
+		t.Errorf("partial result not returned: %+v", result)
+	}
+}
+
+func TestCatchAbortOtherPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("got panic %v, want boom", r)
+		}
+	}()
+	catchAbort(func() { panic("boom") })
+	t.Error("panic was swallowed")
+}
+
+func TestBadDiskDeviceFilter(t *testing.T) {
+	o := DefaultCollectConfig()
+	o.DiskDeviceFilter = []string{"sd*", "nvme[0-"}
+	if _, err := CollectWithContext(context.Background(), o); err == nil {
+		t.Error("no error for bad disk device pattern")
+	}
+}
@@ -18,7 +18,6 @@ package collector
 
 import (
 	"context"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -43,13 +42,13 @@ func (c *collector) collectPgpool() {
  */
 
 func (c *collector) getPPVersion() string {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	// get raw version
 	var version string
 	if err := c.db.QueryRowContext(ctx, "SHOW POOL_VERSION").Scan(&version); err != nil {
-		log.Fatalf("pgpool: show pool_version query failed: %v", err)
+		c.fatalf("pgpool: show pool_version query failed: %v", err)
 	}
 
 	// check if semver
@@ -58,7 +57,7 @@ func (c *collector) getPPVersion() string {
 		semversion = parts[0]
 	}
 	if !semver.IsValid(semversion) {
-		log.Fatalf("pgpool: show pool_version query: invalid version %q", version)
+		c.fatalf("pgpool: show pool_version query: invalid version %q", version)
 	}
 	c.result.Pgpool.Version = version // use full version in output
 
@@ -81,12 +80,12 @@ func (c *collector) getPPVersion() string {
  */
 
 func (c *collector) getPPNodes() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW POOL_NODES")
 	if err != nil {
-		log.Fatalf("pgpool: show pool_nodes query failed: %v", err)
+		c.fatalf("pgpool: show pool_nodes query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -113,10 +112,10 @@ func (c *collector) getPPNodes() {
 				&b.LoadBalanceNode, &replicationDelay, &b.ReplicationState,
 				&b.ReplicationSyncState, &lastStatusChange)
 		} else {
-			log.Fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_NODES'", ncols)
+			c.fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_NODES'", ncols)
 		}
 		if err != nil {
-			log.Fatalf("pgpool: show pool_nodes query scan failed: %v", err)
+			c.fatalf("pgpool: show pool_nodes query scan failed: %v", err)
 		}
 		b.LastStatusChange = pgpoolScanTime(lastStatusChange)
 		if strings.Contains(replicationDelay, "second") {
@@ -129,7 +128,7 @@ func (c *collector) getPPNodes() {
 		c.result.Pgpool.Backends = append(c.result.Pgpool.Backends, b)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgpool: show pool_nodes query rows failed: %v", err)
+		c.fatalf("pgpool: show pool_nodes query rows failed: %v", err)
 	}
 }
 
@@ -159,12 +158,12 @@ func (c *collector) getPPHCStats(semversion string) {
 		return // no health check stats
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW POOL_HEALTH_CHECK_STATS")
 	if err != nil {
-		log.Fatalf("pgpool: show pool_health_check_stats query failed: %v", err)
+		c.fatalf("pgpool: show pool_health_check_stats query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -173,7 +172,7 @@ func (c *collector) getPPHCStats(semversion string) {
 		ncols = len(cols)
 	}
 	if ncols != 20 {
-		log.Fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_HEALTH_CHECK_STATS'", ncols)
+		c.fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_HEALTH_CHECK_STATS'", ncols)
 	}
 
 	for rows.Next() {
@@ -188,7 +187,7 @@ func (c *collector) getPPHCStats(semversion string) {
 			&avgDuration, &lastHealthCheck, &lastSuccessHealthCheck,
 			&lastSkipHealthCheck, &lastFailedHealthCheck)
 		if err != nil {
-			log.Fatalf("pgpool: show pool_health_check_stats query scan failed: %v", err)
+			c.fatalf("pgpool: show pool_health_check_stats query scan failed: %v", err)
 		}
 		for i := range c.result.Pgpool.Backends {
 			b0 := &c.result.Pgpool.Backends[i]
@@ -212,7 +211,7 @@ func (c *collector) getPPHCStats(semversion string) {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgpool: show pool_health_check_stats query rows failed: %v", err)
+		c.fatalf("pgpool: show pool_health_check_stats query rows failed: %v", err)
 	}
 }
 
@@ -231,12 +230,12 @@ func (c *collector) getPPBEStats(semversion string) {
 		return // no backend stats
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW POOL_BACKEND_STATS")
 	if err != nil {
-		log.Fatalf("pgpool: show pool_backend_stats query failed: %v", err)
+		c.fatalf("pgpool: show pool_backend_stats query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -245,7 +244,7 @@ func (c *collector) getPPBEStats(semversion string) {
 		ncols = len(cols)
 	}
 	if ncols != 14 {
-		log.Fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_BACKEND_STATS'", ncols)
+		c.fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_BACKEND_STATS'", ncols)
 	}
 
 	for rows.Next() {
@@ -255,7 +254,7 @@ func (c *collector) getPPBEStats(semversion string) {
 			&b.DeleteCount, &b.DDLCount, &b.OtherCount, &b.PanicCount,
 			&b.FatalCount, &b.ErrorCount)
 		if err != nil {
-			log.Fatalf("pgpool: show pool_backend_stats query scan failed: %v", err)
+			c.fatalf("pgpool: show pool_backend_stats query scan failed: %v", err)
 		}
 		for i := range c.result.Pgpool.Backends {
 			b0 := &c.result.Pgpool.Backends[i]
@@ -274,7 +273,7 @@ func (c *collector) getPPBEStats(semversion string) {
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgpool: show pool_backend_stats query rows failed: %v", err)
+		c.fatalf("pgpool: show pool_backend_stats query rows failed: %v", err)
 	}
 }
 
@@ -295,12 +294,12 @@ func (c *collector) getPPBEStats(semversion string) {
  */
 
 func (c *collector) getPPCache() {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
 	defer cancel()
 
 	rows, err := c.db.QueryContext(ctx, "SHOW POOL_CACHE")
 	if err != nil {
-		log.Fatalf("pgpool: show pool_cache query failed: %v", err)
+		c.fatalf("pgpool: show pool_cache query failed: %v", err)
 	}
 	defer rows.Close()
 
@@ -309,7 +308,7 @@ func (c *collector) getPPCache() {
 		ncols = len(cols)
 	}
 	if ncols != 9 {
-		log.Fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_CACHE'", ncols)
+		c.fatalf("pgpool: unsupported number of columns %d in 'SHOW POOL_CACHE'", ncols)
 	}
 
 	q := &c.result.Pgpool.QueryCache
@@ -319,10 +318,10 @@ func (c *collector) getPPCache() {
 			&q.UsedCacheEntriesSize, &q.FreeCacheEntriesSize,
 			&q.FragmentCacheEntriesSize)
 		if err != nil {
-			log.Fatalf("pgpool: show pool_cache query scan failed: %v", err)
+			c.fatalf("pgpool: show pool_cache query scan failed: %v", err)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("pgpool: show pool_cache query rows failed: %v", err)
+		c.fatalf("pgpool: show pool_cache query rows failed: %v", err)
 	}
 }
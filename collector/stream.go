@@ -0,0 +1,105 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// writeSection writes out one section in streaming mode, and does nothing
+// otherwise. After a write fails, further writes are not attempted. Returns
+// the data of the section, or nil if it was not written.
+func (c *collector) writeSection(section, dbname string, v interface{}) json.RawMessage {
+	if c.stream == nil || c.streamErr != nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.streamErr = err
+		return nil
+	}
+	if c.streamErr = c.stream.Encode(pgmetrics.ModelSection{
+		Section: section,
+		DBName:  dbname,
+		Data:    data,
+	}); c.streamErr != nil {
+		return nil
+	}
+	return data
+}
+
+// writeClusterSection writes out the "cluster" section, and remembers its
+// top-level fields so that writeEndSection can leave them out.
+func (c *collector) writeClusterSection() {
+	if data := c.writeSection("cluster", "", &c.result); data != nil {
+		c.streamErr = json.Unmarshal(data, &c.streamed)
+	}
+}
+
+// writeSystemSection writes out the "system" section, and remembers it like
+// writeClusterSection.
+func (c *collector) writeSystemSection() {
+	if data := c.writeSection("system", "", c.result.System); data != nil && c.streamed != nil {
+		c.streamed["system"] = data
+	}
+}
+
+// writeEndSection writes out the "end" section, with only those top-level
+// fields of the result that were not already written out unchanged in the
+// "cluster" and "system" sections.
+func (c *collector) writeEndSection() {
+	if c.stream == nil || c.streamErr != nil {
+		return
+	}
+	if c.streamed == nil { // pgbouncer or pgpool, no "cluster" section
+		c.writeSection("end", "", &c.result)
+		return
+	}
+	data, err := json.Marshal(&c.result)
+	if err != nil {
+		c.streamErr = err
+		return
+	}
+	var fields map[string]json.RawMessage
+	if c.streamErr = json.Unmarshal(data, &fields); c.streamErr != nil {
+		return
+	}
+	for k, v := range fields {
+		if prev, ok := c.streamed[k]; ok && bytes.Equal(prev, v) {
+			delete(fields, k)
+		}
+	}
+	c.writeSection("end", "", fields)
+}
+
+// flushList writes out a database-specific array collected from the database
+// dbname in streaming mode, if it is not empty, and drops it from the result
+// so that memory usage does not grow with the size and number of databases.
+// It does nothing otherwise. Statements are not written out this way, they
+// are cluster-wide and fetched only once, see getStatements.
+func flushList[T any](c *collector, section, dbname string, list *[]T) {
+	if c.stream == nil {
+		return
+	}
+	if len(*list) > 0 {
+		c.writeSection(section, dbname, *list)
+	}
+	*list = nil
+}
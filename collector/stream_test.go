@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rapidloop/pgmetrics"
+	"github.com/rapidloop/pgmetrics/stream"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	c := &collector{ctx: context.Background(), stream: json.NewEncoder(&buf)}
+	c.result.Metadata.Version = pgmetrics.ModelSchemaVersion
+	c.result.SystemIdentifier = "7000000000000000001"
+	c.writeClusterSection()
+	c.result.System = &pgmetrics.SystemMetrics{NumCores: 4, Hostname: "db1"}
+	c.writeSystemSection()
+	c.result.Tables = []pgmetrics.Table{{OID: 1, DBName: "app", Name: "t1"}, {OID: 2, DBName: "app", Name: "t2"}}
+	c.result.Indexes = []pgmetrics.Index{{OID: 3, DBName: "app", Name: "t1_pkey"}}
+	flushList(c, "tables", "app", &c.result.Tables)
+	flushList(c, "indexes", "app", &c.result.Indexes)
+	flushList(c, "sequences", "app", &c.result.Sequences) // empty, not written
+	c.result.Statements = []pgmetrics.Statement{{QueryID: 42}}
+	if _, err := c.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if c.result.Tables != nil || c.result.Indexes != nil {
+		t.Error("tables and indexes were not dropped after being written")
+	}
+
+	ch, err := stream.ReadStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sections []string
+	var model pgmetrics.Model
+	var system pgmetrics.SystemMetrics
+	var tables []pgmetrics.Table
+	for s := range ch {
+		if err := stream.Err(s); err != nil {
+			t.Fatal(err)
+		}
+		sections = append(sections, s.Section+"/"+s.DBName)
+		var err error
+		switch s.Section {
+		case "cluster", "end":
+			err = json.Unmarshal(s.Data, &model)
+		case "system":
+			err = json.Unmarshal(s.Data, &system)
+		case "tables":
+			err = json.Unmarshal(s.Data, &tables)
+		}
+		if err != nil {
+			t.Fatalf("section %s: %v", s.Section, err)
+		}
+	}
+
+	want := []string{"cluster/", "system/", "tables/app", "indexes/app", "end/"}
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("got sections %v, want %v", sections, want)
+	}
+	if model.SystemIdentifier != "7000000000000000001" || len(model.Statements) != 1 || model.Statements[0].QueryID != 42 {
+		t.Errorf("cluster and end sections not merged correctly: %+v", model)
+	}
+	if system.NumCores != 4 || system.Hostname != "db1" {
+		t.Errorf("got system %+v", system)
+	}
+	if len(tables) != 2 || tables[1].Name != "t2" {
+		t.Errorf("got tables %+v", tables)
+	}
+}
+
+func TestStreamEndSectionDiff(t *testing.T) {
+	var buf bytes.Buffer
+	c := &collector{ctx: context.Background(), stream: json.NewEncoder(&buf)}
+	c.result.SystemIdentifier = "7000000000000000001"
+	c.writeClusterSection()
+	if _, err := c.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := stream.ReadStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := range ch {
+		if s.Section != "end" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(s.Data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fields["system_identifier"]; ok {
+			t.Errorf("unchanged field repeated in end section: %s", s.Data)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// sysWarnf records a problem encountered while collecting system metrics, so
+// that the user can find out why a field was left empty.
+func (c *collector) sysWarnf(format string, args ...interface{}) {
+	c.result.System.Warnings = append(c.result.System.Warnings, fmt.Sprintf(format, args...))
+}
+
+// callWithTimeout calls fn in a separate goroutine, and gives up waiting for
+// it when ctx is done or the timeout (if non-zero) expires, whichever is
+// first. The goroutine is leaked if fn never returns, which is all we can do
+// for a syscall that is stuck in the kernel, like one on a hung NFS mount.
+func callWithTimeout[T any](ctx context.Context, timeout time.Duration, fn func() (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		val T
+		err error
+	}
+	ch := make(chan result, 1) // buffered, so that a late result does not block
+	go func() {
+		var r result
+		r.val, r.err = fn()
+		ch <- r
+	}()
+
+	select {
+	case r := <-ch:
+		return r.val, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// readFile is like os.ReadFile, but gives up after the query timeout or if
+// the collection is cancelled.
+func (c *collector) readFile(name string) ([]byte, error) {
+	return callWithTimeout(c.ctx, c.timeout, func() ([]byte, error) {
+		return os.ReadFile(name)
+	})
+}
+
+// procPath returns the absolute path name of a file in /proc, /etc or /usr,
+// placed under the ProcRoot, if one was set.
+func (c *collector) procPath(name string) string {
+	if c.procRoot == "" {
+		return name
+	}
+	return filepath.Join(c.procRoot, name)
+}
+
+// sysPath returns the absolute path name of a file in /sys, placed under the
+// SysRoot, if one was set.
+func (c *collector) sysPath(name string) string {
+	if c.sysRoot == "" {
+		return name
+	}
+	return filepath.Join(c.sysRoot, name)
+}
+
+// readDir is like os.ReadDir, but gives up after the query timeout or if the
+// collection is cancelled.
+func (c *collector) readDir(name string) ([]os.DirEntry, error) {
+	return callWithTimeout(c.ctx, c.timeout, func() ([]os.DirEntry, error) {
+		return os.ReadDir(name)
+	})
+}
+
+func (c *collector) doStatFS(t *pgmetrics.Tablespace, timeout time.Duration) {
+	if du, ok := c.statFS(t.Location, timeout); ok {
+		t.DiskUsed = du.DiskUsed
+		t.DiskTotal = du.DiskTotal
+		t.DiskAvailable = du.DiskAvailable
+		t.DiskReserved = du.DiskReserved
+		t.InodesUsed = du.InodesUsed
+		t.InodesTotal = du.InodesTotal
+	}
+}
+
+// getTablespaceMounts fills in the mount point of each tablespace, and flags
+// the tablespaces that are on the same filesystem (device) as another.
+func (c *collector) getTablespaceMounts(timeout time.Duration) {
+	devs := make([]uint64, len(c.result.Tablespaces))
+	count := make(map[uint64]int)
+	for i := range c.result.Tablespaces {
+		t := &c.result.Tablespaces[i]
+		if len(t.Location) == 0 {
+			continue
+		}
+		m, err := callWithTimeout(c.ctx, timeout, func() (mountInfo, error) {
+			return findMountPoint(t.Location)
+		})
+		if err != nil {
+			c.sysWarnf("failed to find mount point of %s: %v", t.Location, err)
+			continue
+		}
+		t.MountPoint = m.path
+		devs[i] = m.dev
+		count[m.dev]++
+	}
+	for i := range c.result.Tablespaces {
+		if t := &c.result.Tablespaces[i]; t.MountPoint != "" && count[devs[i]] > 1 {
+			t.SharesStorage = true
+		}
+	}
+}
+
+type mountInfo struct {
+	path string // the mount point
+	dev  uint64 // the device of the filesystem mounted there
+}
+
+// findMountPoint returns the mount point of the filesystem containing path,
+// by walking up from path (with symlinks resolved) until the device changes.
+func findMountPoint(path string) (m mountInfo, err error) {
+	if m.path, err = filepath.EvalSymlinks(path); err != nil {
+		return
+	}
+	if m.dev, err = deviceOf(m.path); err != nil {
+		return
+	}
+	for {
+		parent := filepath.Dir(m.path)
+		if parent == m.path {
+			return // reached "/"
+		}
+		dev, err := deviceOf(parent)
+		if err != nil {
+			return m, err
+		}
+		if dev != m.dev {
+			return m, nil
+		}
+		m.path = parent
+	}
+}
+
+// getDataDirDisks fills in the disk usage of the data directory and of the
+// WAL directory, which is often a symlink to a separate filesystem. Both are
+// filled in even if they are on the same filesystem.
+func (c *collector) getDataDirDisks(timeout time.Duration) {
+	if len(c.dataDir) == 0 {
+		return
+	}
+	if path, ok := c.evalSymlinks(c.dataDir, timeout); ok {
+		if du, ok := c.statFS(path, timeout); ok {
+			c.result.DataDirDisk = &du
+		}
+	}
+
+	walDir := "pg_wal"
+	if c.version < pgv10 {
+		walDir = "pg_xlog"
+	}
+	if path, ok := c.evalSymlinks(filepath.Join(c.dataDir, walDir), timeout); ok {
+		if du, ok := c.statFS(path, timeout); ok {
+			c.result.WALDirDisk = &du
+		}
+	}
+}
+
+// evalSymlinks returns path with all symlinks resolved, giving up after
+// timeout (if non-zero), like statFS.
+func (c *collector) evalSymlinks(path string, timeout time.Duration) (string, bool) {
+	out, err := callWithTimeout(c.ctx, timeout, func() (string, error) {
+		return filepath.EvalSymlinks(path)
+	})
+	if err == context.DeadlineExceeded {
+		c.sysWarnf("resolving %s timed out after %v", path, timeout)
+		return "", false
+	} else if err != nil {
+		c.sysWarnf("failed to resolve %s: %v", path, err)
+		return "", false
+	}
+	return out, true
+}
+
+// statFS returns the disk usage of the filesystem containing path, giving up
+// after timeout (if non-zero).
+func (c *collector) statFS(path string, timeout time.Duration) (du pgmetrics.DiskUsage, ok bool) {
+	if len(path) == 0 {
+		return
+	}
+	du, err := callWithTimeout(c.ctx, timeout, func() (pgmetrics.DiskUsage, error) {
+		return statfs(path)
+	})
+	if err == context.DeadlineExceeded {
+		c.sysWarnf("statfs %s timed out after %v", path, timeout)
+		return
+	} else if err != nil {
+		c.sysWarnf("statfs %s failed: %v", path, err) // not fatal
+		return
+	}
+	du.Path = path
+	return du, true
+}
+
+// utsString converts a NUL-terminated field of syscall.Utsname to a string.
+// The fields are int8 on some architectures and uint8 on others.
+func utsString[T int8 | uint8](field []T) string {
+	b := make([]byte, 0, len(field))
+	for _, v := range field {
+		if v == 0 {
+			break
+		}
+		b = append(b, byte(v))
+	}
+	return string(b)
+}
+
+// parseOSRelease parses the shell-compatible VAR=value lines of os-release.
+// Values may be quoted with single or double quotes.
+func parseOSRelease(raw []byte) map[string]string {
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if v, err := strconv.Unquote(value); err == nil {
+			value = v
+		}
+		out[key] = value
+	}
+	return out
+}
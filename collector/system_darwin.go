@@ -16,6 +16,52 @@
 
 package collector
 
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// collectSystem collects only the hostname and OS information on Darwin for
+// now, the other metrics are not implemented yet.
 func (c *collector) collectSystem(o CollectConfig) {
-	// Not implemented for Darwin yet.
+	c.result.System = &pgmetrics.SystemMetrics{}
+	c.result.System.Hostname, _ = os.Hostname()
+	c.getOSInfo()
+}
+
+// getOSInfo collects the kernel version and the macOS version. Darwin does
+// not have uname(2) in the syscall package, but the same information is
+// available from sysctl.
+func (c *collector) getOSInfo() {
+	s := c.result.System
+	for _, v := range []struct {
+		name string
+		dest *string
+	}{
+		{"kern.osrelease", &s.KernelRelease},
+		{"kern.version", &s.KernelVersion},
+		{"hw.machine", &s.Machine},
+		{"kern.osproductversion", &s.OSVersion}, // macOS 10.13.4 and later
+	} {
+		val, err := syscall.Sysctl(v.name)
+		if err != nil {
+			c.sysWarnf("sysctl %s failed: %v", v.name, err)
+			continue
+		}
+		*v.dest = val
+	}
+	s.OSName = "macOS"
+}
+
+// statfs is not implemented for Darwin yet.
+func statfs(path string) (pgmetrics.DiskUsage, error) {
+	return pgmetrics.DiskUsage{}, errors.New("not implemented for Darwin yet")
+}
+
+// deviceOf is not implemented for Darwin yet.
+func deviceOf(path string) (uint64, error) {
+	return 0, errors.New("not implemented for Darwin yet")
 }
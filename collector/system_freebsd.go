@@ -16,6 +16,270 @@
 
 package collector
 
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+	"golang.org/x/sys/unix"
+)
+
 func (c *collector) collectSystem(o CollectConfig) {
-	// Not implemented for FreeBSD yet.
+	c.result.System = &pgmetrics.SystemMetrics{}
+
+	// Each of these is run in turn, stopping early if the collection is
+	// cancelled. Disk I/O stats, cgroups and the postmaster's resource usage
+	// are not collected on FreeBSD.
+	steps := []func(){
+		// 1. disk space for each tablespace, and for the data and WAL
+		// directories. For ZFS, these are the values for the dataset.
+		func() {
+			statfsTimeout := time.Duration(o.StatFSTimeoutSec) * time.Second
+			for i := range c.result.Tablespaces {
+				c.doStatFS(&c.result.Tablespaces[i], statfsTimeout)
+			}
+			c.getTablespaceMounts(statfsTimeout)
+			c.getDataDirDisks(statfsTimeout)
+		},
+
+		// 2. cpu model, core count
+		c.getCPUs,
+
+		// 3. load average
+		c.getLoadAvg,
+
+		// 4. memory info: used, free, buffers, cached; swapused, swapfree
+		c.getMemory,
+		c.getSwap,
+
+		// 5. hostname
+		func() { c.result.System.Hostname, _ = os.Hostname() },
+
+		// 6. kernel shared memory, semaphore and file descriptor limits
+		c.getKernelIPCLimits,
+
+		// 7. kernel version, distribution name and version
+		c.getOSInfo,
+	}
+	for _, step := range steps {
+		if c.ctx.Err() != nil {
+			return
+		}
+		step()
+	}
+}
+
+// statfs returns the disk usage of the filesystem containing path, leaving
+// the Path field empty.
+func statfs(path string) (du pgmetrics.DiskUsage, err error) {
+	var buf unix.Statfs_t
+	if err = unix.Statfs(path, &buf); err != nil {
+		return
+	}
+	// bavail is negative if root has dipped into the reserved space
+	bavail := max(buf.Bavail, 0)
+	du.DiskUsed = int64(buf.Bsize) * int64(buf.Blocks-buf.Bfree)
+	du.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
+	du.DiskAvailable = int64(buf.Bsize) * bavail
+	du.DiskReserved = int64(buf.Bsize) * (int64(buf.Bfree) - bavail)
+	du.InodesUsed = int64(buf.Files) - buf.Ffree
+	du.InodesTotal = int64(buf.Files)
+	return
+}
+
+// deviceOf returns the id of the device containing the file.
+func deviceOf(path string) (uint64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Dev, nil
+}
+
+func (c *collector) getCPUs() {
+	if model, err := unix.Sysctl("hw.model"); err != nil {
+		c.sysWarnf("sysctl hw.model failed: %v", err)
+	} else {
+		c.result.System.CPUModel = model
+	}
+	if n, err := unix.SysctlUint32("hw.ncpu"); err != nil {
+		c.sysWarnf("sysctl hw.ncpu failed: %v", err)
+	} else {
+		c.result.System.NumCores = int(n)
+	}
+}
+
+func (c *collector) getLoadAvg() {
+	// struct loadavg { fixpt_t ldavg[3]; long fscale; }, where fixpt_t is
+	// a uint32 and long is 4 or 8 bytes depending on the architecture
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		c.sysWarnf("sysctl vm.loadavg failed: %v", err)
+		return
+	}
+	var fscale uint64
+	switch len(raw) {
+	case 16:
+		fscale = uint64(binary.NativeEndian.Uint32(raw[12:]))
+	case 24:
+		fscale = binary.NativeEndian.Uint64(raw[16:])
+	default:
+		c.sysWarnf("sysctl vm.loadavg: unexpected size %d", len(raw))
+		return
+	}
+	if fscale > 0 {
+		c.result.System.LoadAvg = float64(binary.NativeEndian.Uint32(raw)) / float64(fscale)
+	}
+}
+
+// getMemory maps the FreeBSD page queues to the Linux-style fields: inactive
+// and laundry pages (and the ZFS ARC, if any) are counted as cached, and the
+// buffer cache as buffers.
+func (c *collector) getMemory() {
+	var pageSize, total, free, inactive, laundry int64
+	for _, v := range []struct {
+		name string
+		dest *int64
+	}{
+		{"vm.stats.vm.v_page_size", &pageSize},
+		{"vm.stats.vm.v_page_count", &total},
+		{"vm.stats.vm.v_free_count", &free},
+		{"vm.stats.vm.v_inactive_count", &inactive},
+	} {
+		val, err := sysctlInt(v.name)
+		if err != nil {
+			c.sysWarnf("sysctl %s failed: %v", v.name, err)
+			return
+		}
+		*v.dest = val
+	}
+	// optional: laundry queue is in 12.0+, ARC only if zfs is loaded
+	laundry, _ = sysctlInt("vm.stats.vm.v_laundry_count")
+	arc, _ := sysctlInt("kstat.zfs.misc.arcstats.size")
+	bufspace, _ := sysctlInt("vfs.bufspace")
+
+	s := c.result.System
+	s.MemFree = free * pageSize
+	s.MemCached = (inactive+laundry)*pageSize + arc
+	s.MemBuffers = bufspace
+	s.MemUsed = max(total*pageSize-s.MemFree-s.MemCached-s.MemBuffers, 0)
+}
+
+// getSwap adds up the size and usage of all the swap devices, each of which
+// is described by a struct xswdev at the sysctl vm.swap_info.N.
+func (c *collector) getSwap() {
+	pageSize, err := sysctlInt("vm.stats.vm.v_page_size")
+	if err != nil {
+		c.sysWarnf("sysctl vm.stats.vm.v_page_size failed: %v", err)
+		return
+	}
+	var total, used int64
+	for i := 0; ; i++ {
+		raw, err := unix.SysctlRaw("vm.swap_info", i)
+		if err != nil {
+			break // ENOENT after the last device
+		}
+		// struct xswdev { u_int xsw_version; dev_t xsw_dev; int xsw_flags;
+		// int xsw_nblks; int xsw_used; }, where dev_t is a uint64 that is
+		// 4-byte aligned on i386 and 8-byte aligned elsewhere
+		var nblksOff int
+		switch len(raw) {
+		case 24:
+			nblksOff = 16
+		case 32:
+			nblksOff = 20
+		default:
+			c.sysWarnf("sysctl vm.swap_info: unexpected size %d", len(raw))
+			return
+		}
+		if v := binary.NativeEndian.Uint32(raw); v != 2 {
+			c.sysWarnf("sysctl vm.swap_info: unsupported version %d", v)
+			return
+		}
+		total += int64(int32(binary.NativeEndian.Uint32(raw[nblksOff:])))
+		used += int64(int32(binary.NativeEndian.Uint32(raw[nblksOff+4:])))
+	}
+	c.result.System.SwapUsed = used * pageSize
+	c.result.System.SwapFree = (total - used) * pageSize
+}
+
+// getKernelIPCLimits collects the SysV IPC limits, which are available only
+// if the sysvshm and sysvsem modules are loaded, and the open files limit.
+func (c *collector) getKernelIPCLimits() {
+	s := c.result.System
+	for _, v := range []struct {
+		name string
+		dest *int64
+	}{
+		{"kern.ipc.shmmax", &s.ShmMax},
+		{"kern.ipc.shmall", &s.ShmAll},
+		{"kern.ipc.shmmni", &s.ShmMni},
+		{"kern.maxfiles", &s.FileMax},
+	} {
+		val, err := sysctlInt(v.name)
+		if err != nil {
+			c.sysWarnf("sysctl %s failed: %v", v.name, err)
+			continue
+		}
+		*v.dest = val
+	}
+
+	// like kernel.sem on Linux, set only if all four are available
+	var sem [4]int64
+	for i, name := range []string{"kern.ipc.semmsl", "kern.ipc.semmns", "kern.ipc.semopm", "kern.ipc.semmni"} {
+		val, err := sysctlInt(name)
+		if err != nil {
+			c.sysWarnf("sysctl %s failed: %v", name, err)
+			return
+		}
+		sem[i] = val
+	}
+	s.SemParams = &sem
+}
+
+// getOSInfo collects the kernel version, and the name and version of the
+// OS. Recent releases have an /etc/os-release, for older ones the values
+// from uname are used.
+func (c *collector) getOSInfo() {
+	s := c.result.System
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		c.sysWarnf("uname failed: %v", err)
+	} else {
+		s.KernelRelease = utsString(uts.Release[:])
+		s.KernelVersion = utsString(uts.Version[:])
+		s.Machine = utsString(uts.Machine[:])
+		s.OSName = utsString(uts.Sysname[:])
+		s.OSVersion = s.KernelRelease
+	}
+
+	if raw, err := c.readFile(c.procPath("/etc/os-release")); err == nil {
+		vars := parseOSRelease(raw)
+		if name := vars["PRETTY_NAME"]; name != "" {
+			s.OSName = name
+		} else if name := vars["NAME"]; name != "" {
+			s.OSName = name
+		}
+		if ver := vars["VERSION_ID"]; ver != "" {
+			s.OSVersion = ver
+		}
+	}
+}
+
+// sysctlInt returns the value of an integer sysctl, which can be 4 or 8
+// bytes long (like int and long).
+func sysctlInt(name string) (int64, error) {
+	raw, err := unix.SysctlRaw(name)
+	if err != nil {
+		return 0, err
+	}
+	switch len(raw) {
+	case 4:
+		return int64(binary.NativeEndian.Uint32(raw)), nil
+	case 8:
+		return int64(binary.NativeEndian.Uint64(raw)), nil
+	}
+	return 0, fmt.Errorf("unexpected size %d", len(raw))
 }
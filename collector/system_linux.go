@@ -19,10 +19,16 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"math"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/rapidloop/pgmetrics"
 )
@@ -30,50 +36,143 @@ import (
 func (c *collector) collectSystem(o CollectConfig) {
 	c.result.System = &pgmetrics.SystemMetrics{}
 
-	// 1. disk space (bytes free/used/reserved, inodes free/used) for each tablespace
-	for i := range c.result.Tablespaces {
-		c.doStatFS(&c.result.Tablespaces[i])
-	}
+	// /proc/[pid]/status of the postmaster, read in step 10 and used again
+	// in step 15
+	var pmStatus map[string]int64
+
+	// Each of these is run in turn, stopping early if the collection is
+	// cancelled.
+	steps := []func(){
+		// 1. disk space (bytes free/used/reserved, inodes free/used) for each tablespace
+		func() {
+			statfsTimeout := time.Duration(o.StatFSTimeoutSec) * time.Second
+			for i := range c.result.Tablespaces {
+				c.doStatFS(&c.result.Tablespaces[i], statfsTimeout)
+			}
+			c.getTablespaceMounts(statfsTimeout)
+			c.getDataDirDisks(statfsTimeout)
+		},
 
-	// 2. cpu model, core count
-	c.getCPUs()
+		// 2. cpu model, core count
+		c.getCPUs,
 
-	// 3. load average
-	c.getLoadAvg()
+		// 3. load average
+		c.getLoadAvg,
+
+		// 4. memory info: used, free, buffers, cached; swapused, swapfree
+		c.getMemory,
+
+		// 5. hostname
+		func() {
+			if c.procRoot == "" {
+				c.result.System.Hostname, _ = os.Hostname()
+			} else if raw, err := c.readFile(c.procPath("/proc/sys/kernel/hostname")); err == nil {
+				c.result.System.Hostname = string(bytes.TrimSpace(raw))
+			}
+		},
 
-	// 4. memory info: used, free, buffers, cached; swapused, swapfree
-	c.getMemory()
+		// 6. disk I/O statistics and paging counters, and queue settings of
+		// each disk
+		func() {
+			c.getIOStats(o.DiskDeviceFilter, o.ExcludeDiskMajors, o.DiskSampleInterval)
+			c.getBlockQueues()
+		},
 
-	// 5. hostname
-	c.result.System.Hostname, _ = os.Hostname()
+		// 7. kernel shared memory, semaphore and file descriptor limits
+		c.getKernelIPCLimits,
+
+		// 8. postmaster file descriptor usage. The pid in postmaster.pid is
+		// that of the running system, so this and the steps that need it are
+		// skipped when reading from a copy of /proc.
+		func() {
+			if c.procRoot != "" {
+				c.sysWarnf("postmaster and cgroup metrics not collected from %s", c.procRoot)
+				return
+			}
+			c.postmasterPID = c.getPostmasterPID()
+			if c.postmasterPID > 0 && !c.processExists(c.postmasterPID) {
+				c.sysWarnf("postmaster pid %d from postmaster.pid is not running", c.postmasterPID)
+				c.postmasterPID = 0
+			}
+			if c.postmasterPID > 0 {
+				n, err := c.countDirEntries(c.procPath("/proc/" + strconv.Itoa(c.postmasterPID) + "/fdinfo"))
+				if err != nil {
+					c.sysWarnf("failed to count postmaster fds: %v", err)
+				}
+				c.result.System.PostmasterFDCount = n
+			}
+		},
 
-	// 6. disk I/O statistics
-	c.getDiskStats()
+		// 9. cgroup memory and cpu limits, if running in a container
+		func() {
+			if c.procRoot == "" {
+				c.getCgroupLimits()
+			}
+		},
+
+		// 10. resource usage of postmaster and its children
+		func() {
+			if c.postmasterPID > 0 {
+				pmStatus = c.getProcessStats(c.postmasterPID)
+			}
+		},
+
+		// 11. NUMA nodes, with their cpus and memory
+		c.getNUMATopology,
+
+		// 12. kernel version, distribution name and version
+		c.getOSInfo,
+
+		// 13. sockets in use and ephemeral port range
+		c.getTCPStats,
+
+		// 14. temperature sensors
+		c.getSensors,
+
+		// 15. postmaster open file limits and memory usage
+		func() { c.getPostgresProcess(pmStatus) },
+	}
+	for _, step := range steps {
+		if c.ctx.Err() != nil {
+			return
+		}
+		step()
+	}
 }
 
-func (c *collector) doStatFS(t *pgmetrics.Tablespace) {
-	path := t.Location
-	if len(path) == 0 {
+// statfs returns the disk usage of the filesystem containing path, leaving
+// the Path field empty.
+func statfs(path string) (du pgmetrics.DiskUsage, err error) {
+	var buf syscall.Statfs_t
+	if err = syscall.Statfs(path, &buf); err != nil {
 		return
 	}
-	var buf syscall.Statfs_t
-	if err := syscall.Statfs(path, &buf); err != nil {
-		return // ignore errors, not fatal
+	du.DiskUsed = int64(buf.Bsize) * int64(buf.Blocks-buf.Bfree)
+	du.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
+	du.DiskAvailable = int64(buf.Bsize) * int64(buf.Bavail)
+	du.DiskReserved = int64(buf.Bsize) * int64(buf.Bfree-buf.Bavail)
+	du.InodesUsed = int64(buf.Files - buf.Ffree)
+	du.InodesTotal = int64(buf.Files)
+	return
+}
+
+// deviceOf returns the id of the device containing the file.
+func deviceOf(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
 	}
-	t.DiskUsed = int64(buf.Bsize) * int64(buf.Blocks-buf.Bfree)
-	t.DiskTotal = int64(buf.Bsize) * int64(buf.Blocks)
-	t.InodesUsed = int64(buf.Files - buf.Ffree)
-	t.InodesTotal = int64(buf.Files)
+	return uint64(st.Dev), nil
 }
 
 func (c *collector) getCPUs() {
-	f, err := os.Open("/proc/cpuinfo")
+	raw, err := c.readFile(c.procPath("/proc/cpuinfo"))
 	if err != nil {
+		c.sysWarnf("failed to read cpu info: %v", err)
 		return
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "model name") {
@@ -86,24 +185,29 @@ func (c *collector) getCPUs() {
 }
 
 func (c *collector) getLoadAvg() {
-	raw, err := os.ReadFile("/proc/loadavg")
+	raw, err := c.readFile(c.procPath("/proc/loadavg"))
 	if err != nil {
+		c.sysWarnf("failed to read load average: %v", err)
 		return
 	}
 
 	parts := strings.Fields(string(raw))
 	if len(parts) != 5 {
+		c.sysWarnf("unexpected format of /proc/loadavg: %q", raw)
 		return
 	}
 
 	if v, err := strconv.ParseFloat(parts[0], 64); err == nil {
 		c.result.System.LoadAvg = v
+	} else {
+		c.sysWarnf("bad load average in /proc/loadavg: %v", err)
 	}
 }
 
 func (c *collector) getMemory() {
-	raw, err := os.ReadFile("/proc/meminfo")
+	raw, err := c.readFile(c.procPath("/proc/meminfo"))
 	if err != nil {
+		c.sysWarnf("failed to read memory info: %v", err)
 		return
 	}
 	scanner := bufio.NewScanner(bytes.NewReader(raw))
@@ -115,6 +219,7 @@ func (c *collector) getMemory() {
 		if len(fields) == 3 && fields[2] == "kB" {
 			val, err := strconv.ParseInt(fields[1], 10, 64)
 			if err != nil {
+				c.sysWarnf("bad value for %s in /proc/meminfo: %v", fields[0], err)
 				return
 			}
 			memInfo[fields[0]] = val * 1024
@@ -141,96 +246,1017 @@ func (c *collector) getMemory() {
 	}
 }
 
-func (c *collector) getDiskStats() {
-	raw, err := os.ReadFile("/proc/diskstats")
-	if err != nil {
+// getIOStats collects the disk I/O and paging counters. If interval is
+// non-zero, they are read again after the interval, and rates are computed
+// from the difference. The counters reported are those of the last read.
+func (c *collector) getIOStats(filter []string, exclMajors []int, interval time.Duration) {
+	disks, diskOK := c.readDiskStats(filter, exclMajors)
+	vm, vmOK := c.readVMStat()
+	c.result.System.DiskStats = disks
+	c.setVMStat(vm)
+	if interval <= 0 || (!diskOK && !vmOK) {
 		return
 	}
 
+	// sample again after the interval, and compute rates from the two
+	start := time.Now()
+	select {
+	case <-time.After(interval):
+	case <-c.ctx.Done():
+		return
+	}
+	elapsed := time.Since(start).Seconds()
+
+	if after, ok := c.readDiskStats(filter, exclMajors); diskOK && ok {
+		prev := make(map[string]*pgmetrics.DiskStats)
+		for i := range disks {
+			prev[disks[i].DeviceName] = &disks[i]
+		}
+		for i := range after {
+			if p, ok := prev[after[i].DeviceName]; ok {
+				setDiskRates(&after[i], p, elapsed)
+			}
+		}
+		c.result.System.DiskStats = after
+	}
+
+	if after, ok := c.readVMStat(); vmOK && ok {
+		c.setVMStat(after)
+		c.result.System.SwapInRate = float64(pgmetrics.CounterDelta(vm["pswpin"], after["pswpin"])) / elapsed
+		c.result.System.SwapOutRate = float64(pgmetrics.CounterDelta(vm["pswpout"], after["pswpout"])) / elapsed
+	}
+}
+
+// readVMStat reads the counters in /proc/vmstat, which has lines like
+// "pswpin 123".
+func (c *collector) readVMStat() (map[string]int64, bool) {
+	raw, err := c.readFile(c.procPath("/proc/vmstat"))
+	if err != nil {
+		c.sysWarnf("failed to read vmstat: %v", err)
+		return nil, false
+	}
+	out := make(map[string]int64)
 	scanner := bufio.NewScanner(bytes.NewReader(raw))
 	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 14 {
-			continue // skip malformed lines
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			out[fields[0]] = v
 		}
+	}
+	return out, true
+}
 
-		// Parse the basic fields (first 14 are always present)
-		var ds pgmetrics.DiskStats
-		var err error
+func (c *collector) setVMStat(vm map[string]int64) {
+	c.result.System.PgMajFault = vm["pgmajfault"]
+	c.result.System.PSwpIn = vm["pswpin"]
+	c.result.System.PSwpOut = vm["pswpout"]
+}
 
-		if ds.Major, err = strconv.Atoi(fields[0]); err != nil {
+func (c *collector) readDiskStats(filter []string, exclMajors []int) (out []pgmetrics.DiskStats, ok bool) {
+	raw, err := c.readFile(c.procPath("/proc/diskstats"))
+	if err != nil {
+		c.sysWarnf("failed to read disk stats: %v", err)
+		return nil, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := scanner.Text()
+		ds, ok := parseDiskStatsLine(line)
+		if !ok {
+			c.sysWarnf("skipped malformed line in /proc/diskstats: %q", line)
 			continue
 		}
-		if ds.Minor, err = strconv.Atoi(fields[1]); err != nil {
+
+		// Skip loop devices and other non-physical devices
+		if ds.Major == 7 || ds.Major == 11 || ds.Major == 1 {
 			continue
 		}
-		ds.DeviceName = fields[2]
 
-		if ds.ReadsCompleted, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		// Skip devices excluded by the user
+		if !diskDeviceOK(ds, filter, exclMajors) {
 			continue
 		}
-		if ds.ReadsMerged, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+
+		out = append(out, ds)
+	}
+	return out, true
+}
+
+// setDiskRates fills in the rate fields of curr using the counters of an
+// earlier sample prev of the same device, taken elapsed seconds before.
+func setDiskRates(curr, prev *pgmetrics.DiskStats, elapsed float64) {
+	if elapsed <= 0 {
+		return
+	}
+	r := pgmetrics.DiskStatsRates(*prev, *curr, elapsed)
+	curr.SampleSeconds = elapsed
+	curr.ReadsPerSec = r.ReadsPerSec
+	curr.WritesPerSec = r.WritesPerSec
+	curr.ReadBytesPerSec = r.ReadBytesPerSec
+	curr.WriteBytesPerSec = r.WriteBytesPerSec
+	curr.Utilization = r.Utilization
+	curr.AvgQueueSize = r.AvgQueueSize
+}
+
+const sysBlockDir = "/sys/class/block"
+
+// getBlockQueues fills in the I/O scheduler and queue settings of each of the
+// devices in the disk stats. Partitions do not have a queue of their own, the
+// settings of the parent device are used for them.
+func (c *collector) getBlockQueues() {
+	type queue struct {
+		scheduler   string
+		depth       int64
+		readAheadKB int64
+		rotational  *bool
+	}
+	queues := make(map[string]*queue) // by parent device name
+	for i := range c.result.System.DiskStats {
+		ds := &c.result.System.DiskStats[i]
+		parent := c.blockParent(ds.DeviceName)
+		q, ok := queues[parent]
+		if !ok {
+			q = &queue{}
+			dir := filepath.Join(c.sysPath(sysBlockDir), parent, "queue")
+			if raw, err := c.readFile(filepath.Join(dir, "scheduler")); err != nil {
+				c.sysWarnf("failed to get I/O scheduler of %s: %v", parent, err)
+			} else {
+				q.scheduler = activeScheduler(string(raw))
+			}
+			q.depth, _ = c.readProcInt(filepath.Join(dir, "nr_requests"))
+			q.readAheadKB, _ = c.readProcInt(filepath.Join(dir, "read_ahead_kb"))
+			if rot, err := c.readProcInt(filepath.Join(dir, "rotational")); err == nil {
+				q.rotational = new(bool)
+				*q.rotational = rot == 1
+			}
+			queues[parent] = q
+		}
+		ds.Scheduler = q.scheduler
+		ds.QueueDepth = q.depth
+		ds.ReadAheadKB = q.readAheadKB
+		ds.Rotational = q.rotational
+	}
+}
+
+// blockParent returns the name of the whole-disk device of a partition, like
+// "sda" for "sda1" or "nvme0n1" for "nvme0n1p1", and the name itself for
+// devices that are not partitions. The name is also converted to the form
+// used in sysfs, where "/" is replaced by "!" (like "cciss!c0d0").
+func (c *collector) blockParent(name string) string {
+	name = strings.ReplaceAll(name, "/", "!")
+
+	// In sysfs, a partition has a "partition" file, and is a subdirectory
+	// of its parent, like .../block/sda/sda1.
+	dir := filepath.Join(c.sysPath(sysBlockDir), name)
+	if _, err := c.readFile(filepath.Join(dir, "partition")); err != nil {
+		if _, err := c.readFile(filepath.Join(dir, "queue", "scheduler")); err == nil {
+			return name // a whole-disk device
+		}
+		return trimPartition(name) // sysfs not usable, guess from the name
+	}
+	if target, err := os.Readlink(dir); err == nil {
+		return filepath.Base(filepath.Dir(target))
+	}
+	return trimPartition(name)
+}
+
+// trimPartition guesses the parent device of a partition from its name. The
+// partition number is removed from names of the form <disk>p<N> where the
+// disk name ends in a digit (like "nvme0n1p1" or "mmcblk0p2"), and from the
+// names of sd, vd, xvd and hd disks (like "sda1"). Other names (like "dm-0",
+// "md0" or "nvme0n1") are returned unchanged.
+func trimPartition(name string) string {
+	base := strings.TrimRight(name, "0123456789")
+	if base == name || base == "" {
+		return name
+	}
+	if n := len(base); n >= 2 && base[n-1] == 'p' && base[n-2] >= '0' && base[n-2] <= '9' {
+		return base[:n-1]
+	}
+	for _, prefix := range []string{"sd", "vd", "xvd", "hd"} {
+		if rest, ok := strings.CutPrefix(base, prefix); ok && rest != "" &&
+			strings.Trim(rest, "abcdefghijklmnopqrstuvwxyz") == "" {
+			return base
+		}
+	}
+	return name
+}
+
+// activeScheduler returns the active scheduler from the contents of
+// queue/scheduler, which lists the available ones with the active one in
+// brackets, like "none [mq-deadline] kyber bfq". Devices without a choice
+// show just "none".
+func activeScheduler(s string) string {
+	s = strings.TrimSpace(s)
+	if start := strings.IndexByte(s, '['); start != -1 {
+		if end := strings.IndexByte(s[start:], ']'); end != -1 {
+			return s[start+1 : start+end]
+		}
+	}
+	return s
+}
+
+// parseDiskStatsLine parses one line of /proc/diskstats. See
+// https://www.kernel.org/doc/Documentation/ABI/testing/procfs-diskstats
+func parseDiskStatsLine(line string) (ds pgmetrics.DiskStats, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 14 {
+		return ds, false
+	}
+
+	// Parse the basic fields (first 14 are always present)
+	var err error
+
+	if ds.Major, err = strconv.Atoi(fields[0]); err != nil {
+		return ds, false
+	}
+	if ds.Minor, err = strconv.Atoi(fields[1]); err != nil {
+		return ds, false
+	}
+	ds.DeviceName = fields[2]
+
+	if ds.ReadsCompleted, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.ReadsMerged, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.SectorsRead, err = strconv.ParseInt(fields[5], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.ReadTime, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.WritesCompleted, err = strconv.ParseInt(fields[7], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.WritesMerged, err = strconv.ParseInt(fields[8], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.SectorsWritten, err = strconv.ParseInt(fields[9], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.WriteTime, err = strconv.ParseInt(fields[10], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.IOInProgress, err = strconv.ParseInt(fields[11], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.IOTime, err = strconv.ParseInt(fields[12], 10, 64); err != nil {
+		return ds, false
+	}
+	if ds.WeightedIOTime, err = strconv.ParseInt(fields[13], 10, 64); err != nil {
+		return ds, false
+	}
+
+	// Parse optional fields (discard and flush stats, available since kernel 4.18)
+	if len(fields) >= 18 {
+		if ds.DiscardsCompleted, err = strconv.ParseInt(fields[14], 10, 64); err != nil {
+			ds.DiscardsCompleted = 0
+		}
+		if ds.DiscardsMerged, err = strconv.ParseInt(fields[15], 10, 64); err != nil {
+			ds.DiscardsMerged = 0
+		}
+		if ds.SectorsDiscarded, err = strconv.ParseInt(fields[16], 10, 64); err != nil {
+			ds.SectorsDiscarded = 0
+		}
+		if ds.DiscardTime, err = strconv.ParseInt(fields[17], 10, 64); err != nil {
+			ds.DiscardTime = 0
+		}
+	}
+
+	if len(fields) >= 20 {
+		if ds.FlushCompleted, err = strconv.ParseInt(fields[18], 10, 64); err != nil {
+			ds.FlushCompleted = 0
+		}
+		if ds.FlushTime, err = strconv.ParseInt(fields[19], 10, 64); err != nil {
+			ds.FlushTime = 0
+		}
+	}
+
+	return ds, true
+}
+
+// diskDeviceOK checks if the disk device is to be collected, based on the
+// DiskDeviceFilter and ExcludeDiskMajors options. The patterns are checked
+// for validity by CollectWithContext.
+func diskDeviceOK(ds pgmetrics.DiskStats, filter []string, exclMajors []int) bool {
+	for _, m := range exclMajors {
+		if ds.Major == m {
+			return false
+		}
+	}
+	if len(filter) == 0 {
+		return true
+	}
+	for _, pattern := range filter {
+		if ok, _ := path.Match(pattern, ds.DeviceName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *collector) getKernelIPCLimits() {
+	s := c.result.System
+	for _, l := range []struct {
+		file string
+		val  *int64
+	}{
+		{"/proc/sys/kernel/shmmax", &s.ShmMax},
+		{"/proc/sys/kernel/shmall", &s.ShmAll},
+		{"/proc/sys/kernel/shmmni", &s.ShmMni},
+		{"/proc/sys/fs/file-max", &s.FileMax},
+	} {
+		v, err := c.readProcInt(c.procPath(l.file))
+		if err != nil {
+			c.sysWarnf("failed to read kernel limit: %v", err)
 			continue
 		}
-		if ds.SectorsRead, err = strconv.ParseInt(fields[5], 10, 64); err != nil {
+		*l.val = v
+	}
+	sem, err := c.readProcInts(c.procPath("/proc/sys/kernel/sem"))
+	if err != nil {
+		c.sysWarnf("failed to read kernel limit: %v", err)
+	} else if len(sem) != 4 {
+		c.sysWarnf("unexpected format of /proc/sys/kernel/sem: %v", sem)
+	} else {
+		s.SemParams = (*[4]int64)(sem)
+	}
+}
+
+// getPostmasterPID returns the pid of the postmaster, read from the
+// postmaster.pid file in the data directory. Returns 0, with a warning, if
+// the pid could not be determined.
+func (c *collector) getPostmasterPID() int {
+	if len(c.dataDir) == 0 {
+		c.sysWarnf("failed to get postmaster pid: data directory not known")
+		return 0
+	}
+	raw, err := c.readFile(filepath.Join(c.dataDir, "postmaster.pid"))
+	if err != nil {
+		c.sysWarnf("failed to get postmaster pid: %v", err)
+		return 0
+	}
+	// the first line is the pid
+	line, _, _ := strings.Cut(string(raw), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || pid <= 0 {
+		c.sysWarnf("bad pid %q in postmaster.pid", line)
+		return 0
+	}
+	return pid
+}
+
+// readProcInts reads a file containing whitespace-separated integers, like
+// most of the files under /proc/sys. Values that overflow an int64 (for
+// example, the default kernel.shmall on 64-bit kernels) are clamped to
+// math.MaxInt64.
+func (c *collector) readProcInts(path string) ([]int64, error) {
+	raw, err := c.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []int64
+	for _, f := range strings.Fields(string(raw)) {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if v > math.MaxInt64 {
+			v = math.MaxInt64
+		}
+		out = append(out, int64(v))
+	}
+	return out, nil
+}
+
+// readProcInt reads a file containing a single integer.
+func (c *collector) readProcInt(path string) (int64, error) {
+	v, err := c.readProcInts(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 1 {
+		return 0, fmt.Errorf("%s: expected 1 value, got %d", path, len(v))
+	}
+	return v[0], nil
+}
+
+// countDirEntries returns the number of entries in the directory.
+func (c *collector) countDirEntries(dir string) (int64, error) {
+	entries, err := c.readDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(entries)), nil
+}
+
+// cgroupRoot is where the cgroup filesystem(s) are mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited is the threshold above which a cgroup v1 memory limit is
+// considered as "no limit". The kernel reports an unset limit as the largest
+// page-aligned int64.
+const cgroupV1Unlimited = 1 << 62
+
+// getCgroupLimits fills in the memory and cpu limits of the cgroup the
+// postmaster (or if not known, pgmetrics itself) runs under. Both cgroup v1
+// and v2 hierarchies are supported. Limits set on ancestor cgroups are also
+// considered, and the fields are left as zero if there are no limits.
+func (c *collector) getCgroupLimits() {
+	pid := "self"
+	if c.postmasterPID > 0 {
+		pid = strconv.Itoa(c.postmasterPID)
+	}
+	paths, err := c.readCgroupPaths(c.procPath("/proc/" + pid + "/cgroup"))
+	if err != nil {
+		c.sysWarnf("failed to get cgroup: %v", err)
+		return
+	}
+
+	s := c.result.System
+	root := c.sysPath(cgroupRoot)
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		// cgroup v2, single unified hierarchy
+		dirs := cgroupDirs(root, paths[""])
+		if s.CgroupMemLimit = c.cgroupMinInt(dirs, "memory.max", 0); s.CgroupMemLimit > 0 {
+			s.CgroupMemUsed = c.cgroupLeafInt(dirs, "memory.current")
+		}
+		s.CgroupCPULimit = cgroupMinCPU(dirs, func(dir string) (quota, period int64) {
+			// "$MAX $PERIOD", where $MAX can be "max"
+			raw, err := c.readFile(filepath.Join(dir, "cpu.max"))
+			if err != nil {
+				return
+			}
+			f := strings.Fields(string(raw))
+			if len(f) != 2 {
+				return
+			}
+			quota, _ = strconv.ParseInt(f[0], 10, 64)
+			period, _ = strconv.ParseInt(f[1], 10, 64)
+			return
+		})
+		return
+	}
+
+	// cgroup v1, one hierarchy per controller (or group of controllers)
+	if p, ok := paths["memory"]; ok {
+		dirs := cgroupDirs(filepath.Join(root, "memory"), p)
+		if s.CgroupMemLimit = c.cgroupMinInt(dirs, "memory.limit_in_bytes", cgroupV1Unlimited); s.CgroupMemLimit > 0 {
+			s.CgroupMemUsed = c.cgroupLeafInt(dirs, "memory.usage_in_bytes")
+		}
+	}
+	if p, ok := paths["cpu"]; ok {
+		mount := filepath.Join(root, "cpu")
+		if _, err := os.Stat(mount); err != nil {
+			mount = filepath.Join(root, "cpu,cpuacct")
+		}
+		dirs := cgroupDirs(mount, p)
+		s.CgroupCPULimit = cgroupMinCPU(dirs, func(dir string) (quota, period int64) {
+			// quota is -1 if not set, which fails to parse and remains 0
+			quota, _ = c.readProcInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+			period, _ = c.readProcInt(filepath.Join(dir, "cpu.cfs_period_us"))
+			return
+		})
+	}
+}
+
+// readCgroupPaths parses a /proc/<pid>/cgroup file, and returns a map of
+// controller name to cgroup path. The v2 unified hierarchy, if present, is
+// mapped to an empty controller name.
+func (c *collector) readCgroupPaths(file string) (map[string]string, error) {
+	raw, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
 			continue
 		}
-		if ds.ReadTime, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+		if parts[1] == "" {
+			paths[""] = parts[2]
 			continue
 		}
-		if ds.WritesCompleted, err = strconv.ParseInt(fields[7], 10, 64); err != nil {
+		for _, ctl := range strings.Split(parts[1], ",") {
+			paths[ctl] = parts[2]
+		}
+	}
+	return paths, nil
+}
+
+// cgroupDirs returns the directories of the cgroup at cgpath and all its
+// ancestors, in the hierarchy mounted at mount, leaf first. Inside a
+// container, the leaf directories may not be visible, in which case only the
+// root of the hierarchy will be found.
+func cgroupDirs(mount, cgpath string) (dirs []string) {
+	p := path.Clean("/" + cgpath)
+	for {
+		dirs = append(dirs, filepath.Join(mount, p))
+		if p == "/" {
+			return
+		}
+		p = path.Dir(p)
+	}
+}
+
+// cgroupMinInt returns the smallest positive value of the given file across
+// the given cgroup directories, ignoring values at or above unlimited (if
+// non-zero). Returns 0 if there is no such value.
+func (c *collector) cgroupMinInt(dirs []string, file string, unlimited int64) (out int64) {
+	for _, dir := range dirs {
+		v, err := c.readProcInt(filepath.Join(dir, file))
+		if err != nil || v <= 0 || (unlimited > 0 && v >= unlimited) {
 			continue
 		}
-		if ds.WritesMerged, err = strconv.ParseInt(fields[8], 10, 64); err != nil {
+		if out == 0 || v < out {
+			out = v
+		}
+	}
+	return
+}
+
+// cgroupLeafInt returns the value of the given file from the first of the
+// given cgroup directories that has it.
+func (c *collector) cgroupLeafInt(dirs []string, file string) int64 {
+	for _, dir := range dirs {
+		if v, err := c.readProcInt(filepath.Join(dir, file)); err == nil {
+			return v
+		}
+	}
+	return 0
+}
+
+// cgroupMinCPU returns the smallest quota/period ratio across the given
+// cgroup directories, or 0 if there is no cpu quota set.
+func cgroupMinCPU(dirs []string, get func(dir string) (quota, period int64)) (out float64) {
+	for _, dir := range dirs {
+		quota, period := get(dir)
+		if quota <= 0 || period <= 0 {
 			continue
 		}
-		if ds.SectorsWritten, err = strconv.ParseInt(fields[9], 10, 64); err != nil {
+		if v := float64(quota) / float64(period); out == 0 || v < out {
+			out = v
+		}
+	}
+	return
+}
+
+// getProcessStats fills in the resource usage of the postmaster with the
+// given pid, and of all its child processes put together. Information that
+// cannot be read (typically /proc/[pid]/fd if pgmetrics is not running as
+// the same user as postgres, or as root) is left as zero. Returns the
+// contents of the postmaster's /proc/[pid]/status, or nil if not readable.
+func (c *collector) getProcessStats(ppid int) (status map[string]int64) {
+	pm, _, err := c.getProcessStat(ppid)
+	if err != nil {
+		c.sysWarnf("failed to get postmaster process stats: %v", err)
+		return
+	}
+	status = c.getProcessUsage(ppid, &pm)
+	c.result.System.Postmaster = &pm
+
+	entries, err := c.readDir(c.procPath("/proc"))
+	if err != nil {
+		c.sysWarnf("failed to list processes: %v", err)
+		return
+	}
+	children := pgmetrics.ProcessStats{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
 			continue
 		}
-		if ds.WriteTime, err = strconv.ParseInt(fields[10], 10, 64); err != nil {
+		ps, parent, err := c.getProcessStat(pid)
+		if err != nil || parent != ppid {
 			continue
 		}
-		if ds.IOInProgress, err = strconv.ParseInt(fields[11], 10, 64); err != nil {
+		c.getProcessUsage(pid, &ps)
+		children.NumProcesses++
+		children.RSS += ps.RSS
+		children.VSize += ps.VSize
+		children.UserCPU += ps.UserCPU
+		children.SystemCPU += ps.SystemCPU
+		children.NumThreads += ps.NumThreads
+		children.NumFDs += ps.NumFDs
+	}
+	if children.NumProcesses > 0 {
+		c.result.System.PostmasterChildren = &children
+	}
+	return
+}
+
+// getProcessStat returns the resource usage and the parent pid of the process
+// with the given pid, from /proc/[pid]/stat only. The RSS and the open file
+// count are filled in by getProcessUsage, which is called only for processes
+// that are of interest.
+func (c *collector) getProcessStat(pid int) (ps pgmetrics.ProcessStats, ppid int, err error) {
+	dir := c.procPath("/proc/" + strconv.Itoa(pid))
+
+	// see proc(5) for the format of /proc/[pid]/stat
+	raw, err := c.readFile(dir + "/stat")
+	if err != nil {
+		return
+	}
+	// skip over "pid (comm)", comm can contain spaces and parens
+	pos := bytes.LastIndexByte(raw, ')')
+	if pos == -1 {
+		err = fmt.Errorf("%s/stat: bad format", dir)
+		return
+	}
+	// fields[0] is field #3 ("state") in proc(5)
+	fields := strings.Fields(string(raw[pos+1:]))
+	if len(fields) < 22 {
+		err = fmt.Errorf("%s/stat: bad format", dir)
+		return
+	}
+	ppid, _ = strconv.Atoi(fields[1])
+	ps.UserCPU, _ = strconv.ParseInt(fields[11], 10, 64)
+	ps.SystemCPU, _ = strconv.ParseInt(fields[12], 10, 64)
+	ps.NumThreads, _ = strconv.ParseInt(fields[17], 10, 64)
+	ps.VSize, _ = strconv.ParseInt(fields[20], 10, 64)
+	ps.NumProcesses = 1
+	return
+}
+
+// getProcessUsage fills in the RSS and the open file count of the process
+// with the given pid, and returns its /proc/[pid]/status, or nil if it could
+// not be read.
+func (c *collector) getProcessUsage(pid int, ps *pgmetrics.ProcessStats) map[string]int64 {
+	dir := c.procPath("/proc/" + strconv.Itoa(pid))
+
+	// RSS from status is in bytes rather than pages, use that
+	status, err := c.readProcStatus(dir + "/status")
+	if err == nil {
+		ps.RSS = status["VmRSS"]
+	}
+
+	ps.NumFDs, _ = c.countDirEntries(dir + "/fd") // usually not accessible, leave as 0
+	return status
+}
+
+// readProcStatus reads a /proc/[pid]/status file and returns the numeric
+// values in it. Values in kB are converted to bytes.
+func (c *collector) readProcStatus(file string) (map[string]int64, error) {
+	raw, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
 			continue
 		}
-		if ds.IOTime, err = strconv.ParseInt(fields[12], 10, 64); err != nil {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
 			continue
 		}
-		if ds.WeightedIOTime, err = strconv.ParseInt(fields[13], 10, 64); err != nil {
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
 			continue
 		}
+		if len(fields) == 2 && fields[1] == "kB" {
+			v *= 1024
+		}
+		out[key] = v
+	}
+	return out, nil
+}
 
-		// Parse optional fields (discard and flush stats, available since kernel 4.18)
-		if len(fields) >= 18 {
-			if ds.DiscardsCompleted, err = strconv.ParseInt(fields[14], 10, 64); err != nil {
-				ds.DiscardsCompleted = 0
-			}
-			if ds.DiscardsMerged, err = strconv.ParseInt(fields[15], 10, 64); err != nil {
-				ds.DiscardsMerged = 0
-			}
-			if ds.SectorsDiscarded, err = strconv.ParseInt(fields[16], 10, 64); err != nil {
-				ds.SectorsDiscarded = 0
-			}
-			if ds.DiscardTime, err = strconv.ParseInt(fields[17], 10, 64); err != nil {
-				ds.DiscardTime = 0
-			}
+const sysNodeDir = "/sys/devices/system/node"
+
+// getNUMATopology collects the cpus and memory of each NUMA node. Kernels
+// built without NUMA support do not have /sys/devices/system/node, in which
+// case there is nothing to collect.
+func (c *collector) getNUMATopology() {
+	entries, err := c.readDir(c.sysPath(sysNodeDir))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		c.sysWarnf("failed to read NUMA nodes: %v", err)
+		return
+	}
+
+	var nodes []pgmetrics.NUMANodeStats
+	for _, e := range entries {
+		id, err := strconv.Atoi(strings.TrimPrefix(e.Name(), "node"))
+		if !strings.HasPrefix(e.Name(), "node") || err != nil || id < 0 {
+			continue // "online", "possible", "power" etc.
+		}
+		node := pgmetrics.NUMANodeStats{NodeID: id}
+		dir := filepath.Join(c.sysPath(sysNodeDir), e.Name())
+
+		if raw, err := c.readFile(filepath.Join(dir, "cpulist")); err != nil {
+			c.sysWarnf("failed to read cpus of NUMA node %d: %v", id, err)
+		} else if node.CPUs, err = parseCPUList(strings.TrimSpace(string(raw))); err != nil {
+			c.sysWarnf("failed to parse cpus of NUMA node %d: %v", id, err)
+		}
+
+		// lines are like "Node 0 MemTotal:  6158152 kB"
+		if mi, err := c.readProcStatus(filepath.Join(dir, "meminfo")); err != nil {
+			c.sysWarnf("failed to read memory of NUMA node %d: %v", id, err)
+		} else {
+			prefix := fmt.Sprintf("Node %d ", id)
+			node.MemTotalBytes = mi[prefix+"MemTotal"]
+			node.MemFreeBytes = mi[prefix+"MemFree"]
+			node.MemUsedBytes = mi[prefix+"MemUsed"]
+			node.HugePagesTotal = mi[prefix+"HugePages_Total"]
 		}
 
-		if len(fields) >= 20 {
-			if ds.FlushCompleted, err = strconv.ParseInt(fields[18], 10, 64); err != nil {
-				ds.FlushCompleted = 0
+		nodes = append(nodes, node)
+	}
+
+	// directory entries are sorted by name, which puts node10 before node2
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	c.result.System.NUMANodes = nodes
+}
+
+// parseCPUList parses a list of cpus in the kernel's "cpulist" format, like
+// "0-3,8,10-11". An empty string is a valid, empty list.
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	if s == "" {
+		return cpus, nil
+	}
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("bad cpu list %q", s)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return nil, fmt.Errorf("bad cpu list %q", s)
 			}
-			if ds.FlushTime, err = strconv.ParseInt(fields[19], 10, 64); err != nil {
-				ds.FlushTime = 0
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// getOSInfo collects the kernel version and the name and version of the
+// distribution.
+func (c *collector) getOSInfo() {
+	var uts syscall.Utsname
+	if c.procRoot != "" {
+		// reading from a copy of another host's /proc, which has the same
+		// strings as uname(), except for the machine
+		if raw, err := c.readFile(c.procPath("/proc/sys/kernel/osrelease")); err == nil {
+			c.result.System.KernelRelease = string(bytes.TrimSpace(raw))
+		}
+		if raw, err := c.readFile(c.procPath("/proc/sys/kernel/version")); err == nil {
+			c.result.System.KernelVersion = string(bytes.TrimSpace(raw))
+		}
+	} else if err := syscall.Uname(&uts); err != nil {
+		c.sysWarnf("uname failed: %v", err)
+	} else {
+		c.result.System.KernelRelease = utsString(uts.Release[:])
+		c.result.System.KernelVersion = utsString(uts.Version[:])
+		c.result.System.Machine = utsString(uts.Machine[:])
+	}
+
+	// /etc/os-release is the standard location, with /usr/lib/os-release as
+	// the fallback, see os-release(5).
+	raw, err := c.readFile(c.procPath("/etc/os-release"))
+	if os.IsNotExist(err) {
+		raw, err = c.readFile(c.procPath("/usr/lib/os-release"))
+	}
+	if err != nil {
+		c.sysWarnf("failed to get OS name: %v", err)
+		return
+	}
+	vars := parseOSRelease(raw)
+	if name := vars["PRETTY_NAME"]; name != "" {
+		c.result.System.OSName = name
+	} else {
+		c.result.System.OSName = vars["NAME"]
+	}
+	c.result.System.OSVersion = vars["VERSION_ID"]
+}
+
+// getTCPStats collects socket usage counts and the ephemeral port range.
+func (c *collector) getTCPStats() {
+	var ts pgmetrics.TCPStats
+	ok := false
+
+	// lines are like "TCP: inuse 4 orphan 0 tw 0 alloc 4 mem 1"
+	if ss, err := c.readSockstat(c.procPath("/proc/net/sockstat")); err != nil {
+		c.sysWarnf("failed to read socket stats: %v", err)
+	} else {
+		ts.TCPInUse = ss["TCP"]["inuse"]
+		ts.TCPOrphan = ss["TCP"]["orphan"]
+		ts.TCPTimewait = ss["TCP"]["tw"]
+		ts.TCPAlloc = ss["TCP"]["alloc"]
+		ts.TCPMem = ss["TCP"]["mem"]
+		ts.UDPInUse = ss["UDP"]["inuse"]
+		ok = true
+	}
+
+	// absent if IPv6 is disabled
+	if ss, err := c.readSockstat(c.procPath("/proc/net/sockstat6")); err == nil {
+		ts.TCP6InUse = ss["TCP6"]["inuse"]
+		ts.UDP6InUse = ss["UDP6"]["inuse"]
+	} else if !os.IsNotExist(err) {
+		c.sysWarnf("failed to read IPv6 socket stats: %v", err)
+	}
+
+	if v, err := c.readProcInts(c.procPath("/proc/sys/net/ipv4/ip_local_port_range")); err != nil {
+		c.sysWarnf("failed to read ip_local_port_range: %v", err)
+	} else if len(v) != 2 {
+		c.sysWarnf("bad value for ip_local_port_range: %v", v)
+	} else {
+		ts.EphemeralPortMin = int(v[0])
+		ts.EphemeralPortMax = int(v[1])
+		ok = true
+	}
+
+	if ok {
+		c.result.System.TCPStats = &ts
+	}
+}
+
+// readSockstat reads a file in the format of /proc/net/sockstat, where each
+// line has a protocol followed by name-value pairs, and returns the values
+// keyed by protocol and then by name.
+func (c *collector) readSockstat(file string) (map[string]map[string]int64, error) {
+	raw, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]map[string]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		proto, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		values := make(map[string]int64)
+		fields := strings.Fields(rest)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if v, err := strconv.ParseInt(fields[i+1], 10, 64); err == nil {
+				values[fields[i]] = v
 			}
 		}
+		out[proto] = values
+	}
+	return out, nil
+}
 
-		// Skip loop devices and other non-physical devices
-		if ds.Major == 7 || ds.Major == 11 || ds.Major == 1 {
+const sysHwmonDir = "/sys/class/hwmon"
+
+// getSensors collects the temperature sensors of all the hwmon devices. See
+// https://www.kernel.org/doc/Documentation/hwmon/sysfs-interface
+func (c *collector) getSensors() {
+	entries, err := c.readDir(c.sysPath(sysHwmonDir))
+	if os.IsNotExist(err) {
+		return // usual in VMs and containers
+	} else if err != nil {
+		c.sysWarnf("failed to read hwmon devices: %v", err)
+		return
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "hwmon") {
+			c.getHwmonSensors(filepath.Join(c.sysPath(sysHwmonDir), e.Name()))
+		}
+	}
+}
+
+// getHwmonSensors collects the temperature sensors of one hwmon device,
+// skipping over the ones that cannot be read.
+func (c *collector) getHwmonSensors(dir string) {
+	entries, err := c.readDir(dir)
+	if err != nil {
+		c.sysWarnf("failed to read hwmon device: %v", err)
+		return
+	}
+	var name string
+	if raw, err := c.readFile(filepath.Join(dir, "name")); err == nil {
+		name = strings.TrimSpace(string(raw))
+	}
+	for _, e := range entries {
+		// tempN_input is the temperature, in millidegrees Celsius
+		id, ok := strings.CutSuffix(e.Name(), "_input")
+		if !ok || !strings.HasPrefix(id, "temp") {
 			continue
 		}
+		temp, err := c.readMilliCelsius(filepath.Join(dir, e.Name()))
+		if err != nil {
+			c.sysWarnf("failed to read sensor %s/%s: %v", name, id, err)
+			continue
+		}
+		s := pgmetrics.Sensor{
+			Device:      filepath.Base(dir),
+			ID:          id,
+			Name:        name,
+			Label:       id,
+			TempCelsius: temp,
+		}
+		if raw, err := c.readFile(filepath.Join(dir, id+"_label")); err == nil {
+			s.Label = strings.TrimSpace(string(raw))
+		}
+		if crit, err := c.readMilliCelsius(filepath.Join(dir, id+"_crit")); err == nil {
+			s.CritCelsius = crit
+		}
+		c.result.System.Sensors = append(c.result.System.Sensors, s)
+	}
+}
+
+// readMilliCelsius reads a hwmon temperature file, which contains a signed
+// integer in millidegrees Celsius, and returns the value in degrees.
+func (c *collector) readMilliCelsius(path string) (float64, error) {
+	raw, err := c.readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(v) / 1000, nil
+}
+
+// processExists checks if there is a process with the given pid, so that a
+// pid left over in a stale postmaster.pid is not used.
+func (c *collector) processExists(pid int) bool {
+	_, err := callWithTimeout(c.ctx, c.timeout, func() (os.FileInfo, error) {
+		return os.Stat(c.procPath("/proc/" + strconv.Itoa(pid)))
+	})
+	return err == nil
+}
+
+// getPostgresProcess collects the open file limits of the postmaster, and
+// fills in its open file count and memory usage from what was already
+// collected in the earlier steps, with status being its /proc/[pid]/status.
+// Nothing is filled in if the postmaster pid is not known, a warning having
+// been added already.
+func (c *collector) getPostgresProcess(status map[string]int64) {
+	if c.postmasterPID <= 0 {
+		return
+	}
+	pp := &pgmetrics.PostgreSQLProcessInfo{PostmasterPID: c.postmasterPID}
+	c.result.PostgresProcess = pp
+	dir := c.procPath("/proc/" + strconv.Itoa(c.postmasterPID))
+
+	if soft, hard, err := c.readOpenFilesLimit(dir + "/limits"); err != nil {
+		c.sysWarnf("failed to get postmaster open files limit: %v", err)
+	} else {
+		pp.PostmasterFDSoftLimit = soft
+		pp.PostmasterFDHardLimit = hard
+	}
+
+	// counted from /proc/[pid]/fdinfo in step 8
+	pp.PostmasterFDCurrent = c.result.System.PostmasterFDCount
+
+	pp.VmPeak = status["VmPeak"]
+	pp.VmRSS = status["VmRSS"]
+	pp.VmSwap = status["VmSwap"]
+	pp.Threads = status["Threads"]
+}
+
+// readOpenFilesLimit returns the soft and hard limits from the "Max open
+// files" line of /proc/[pid]/limits, with -1 standing for "unlimited".
+func (c *collector) readOpenFilesLimit(file string) (soft, hard int64, err error) {
+	raw, err := c.readFile(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "Max open files")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			break
+		}
+		if soft, err = parseLimit(fields[0]); err != nil {
+			return 0, 0, err
+		}
+		if hard, err = parseLimit(fields[1]); err != nil {
+			return 0, 0, err
+		}
+		return soft, hard, nil
+	}
+	return 0, 0, fmt.Errorf("%s: no valid \"Max open files\" line", file)
+}
 
-		c.result.System.DiskStats = append(c.result.System.DiskStats, ds)
+func parseLimit(s string) (int64, error) {
+	if s == "unlimited" {
+		return -1, nil
 	}
+	return strconv.ParseInt(s, 10, 64)
 }
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// newTestCollector returns a collector that reads /proc and /sys files from
+// under the given directory in testdata.
+func newTestCollector(root string) *collector {
+	c := &collector{
+		ctx:      context.Background(),
+		timeout:  time.Second,
+		procRoot: "testdata/" + root,
+		sysRoot:  "testdata/" + root,
+	}
+	c.result.System = &pgmetrics.SystemMetrics{}
+	return c
+}
+
+func TestGetCPUs(t *testing.T) {
+	cases := []struct {
+		root     string
+		cores    int
+		cpuModel string
+	}{
+		{"kernel-3.10", 2, "Intel(R) Xeon(R) CPU E5-2670 0 @ 2.60GHz"},
+		{"kernel-4.19", 3, "Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz"},
+		{"kernel-5.15", 4, "AMD EPYC 7R13 Processor"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.root, func(t *testing.T) {
+			c := newTestCollector(tc.root)
+			c.getCPUs()
+			s := c.result.System
+			if s.NumCores != tc.cores || s.CPUModel != tc.cpuModel {
+				t.Errorf("got %d x %q, want %d x %q", s.NumCores, s.CPUModel, tc.cores, tc.cpuModel)
+			}
+			if len(s.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", s.Warnings)
+			}
+		})
+	}
+}
+
+func TestGetLoadAvg(t *testing.T) {
+	cases := []struct {
+		root    string
+		loadAvg float64
+	}{
+		{"kernel-3.10", 0.52},
+		{"kernel-4.19", 3.10},
+		{"kernel-5.15", 12.75},
+	}
+	for _, tc := range cases {
+		t.Run(tc.root, func(t *testing.T) {
+			c := newTestCollector(tc.root)
+			c.getLoadAvg()
+			s := c.result.System
+			if s.LoadAvg != tc.loadAvg {
+				t.Errorf("got %v, want %v", s.LoadAvg, tc.loadAvg)
+			}
+			if len(s.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", s.Warnings)
+			}
+		})
+	}
+}
+
+func TestGetMemory(t *testing.T) {
+	const kB = 1024
+	cases := []struct {
+		root string
+		want pgmetrics.SystemMetrics
+	}{
+		{"kernel-3.10", pgmetrics.SystemMetrics{
+			MemUsed:    3310000 * kB,
+			MemFree:    1200000 * kB,
+			MemBuffers: 100000 * kB,
+			MemCached:  3000000 * kB,
+			MemSlab:    400000 * kB,
+			SwapUsed:   97148 * kB,
+			SwapFree:   2000000 * kB,
+		}},
+		{"kernel-4.19", pgmetrics.SystemMetrics{ // no swap
+			MemUsed:    4306884 * kB,
+			MemFree:    5000000 * kB,
+			MemBuffers: 200000 * kB,
+			MemCached:  6000000 * kB,
+			MemSlab:    800000 * kB,
+		}},
+		{"kernel-5.15", pgmetrics.SystemMetrics{
+			MemUsed:    23342000 * kB,
+			MemFree:    10000000 * kB,
+			MemBuffers: 500000 * kB,
+			MemCached:  30000000 * kB,
+			MemSlab:    2000000 * kB,
+			SwapFree:   8388604 * kB,
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.root, func(t *testing.T) {
+			c := newTestCollector(tc.root)
+			c.getMemory()
+			if got := *c.result.System; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadDiskStats(t *testing.T) {
+	cases := []struct {
+		root string
+		want []pgmetrics.DiskStats
+	}{
+		{"kernel-3.10", []pgmetrics.DiskStats{ // 14 fields
+			{Major: 8, Minor: 0, DeviceName: "sda",
+				ReadsCompleted: 12345, ReadsMerged: 67, SectorsRead: 987654, ReadTime: 4321,
+				WritesCompleted: 23456, WritesMerged: 789, SectorsWritten: 3456789, WriteTime: 98765,
+				IOTime: 54321, WeightedIOTime: 103086},
+			{Major: 8, Minor: 1, DeviceName: "sda1",
+				ReadsCompleted: 12000, ReadsMerged: 60, SectorsRead: 980000, ReadTime: 4300,
+				WritesCompleted: 23000, WritesMerged: 780, SectorsWritten: 3450000, WriteTime: 98000,
+				IOTime: 54000, WeightedIOTime: 102300},
+		}},
+		{"kernel-4.19", []pgmetrics.DiskStats{ // 18 fields, with discards
+			{Major: 259, Minor: 0, DeviceName: "nvme0n1",
+				ReadsCompleted: 5000, ReadsMerged: 10, SectorsRead: 400000, ReadTime: 2500,
+				WritesCompleted: 8000, WritesMerged: 20, SectorsWritten: 640000, WriteTime: 9000,
+				IOTime: 7000, WeightedIOTime: 11500,
+				DiscardsCompleted: 100, SectorsDiscarded: 204800, DiscardTime: 50},
+			{Major: 259, Minor: 1, DeviceName: "nvme0n1p1",
+				ReadsCompleted: 4900, ReadsMerged: 10, SectorsRead: 390000, ReadTime: 2400,
+				WritesCompleted: 7900, WritesMerged: 20, SectorsWritten: 630000, WriteTime: 8900,
+				IOTime: 6900, WeightedIOTime: 11300,
+				DiscardsCompleted: 100, SectorsDiscarded: 204800, DiscardTime: 50},
+		}},
+		{"kernel-5.15", []pgmetrics.DiskStats{ // 20 fields, with discards and flushes
+			{Major: 253, Minor: 0, DeviceName: "vda",
+				ReadsCompleted: 100, ReadsMerged: 1, SectorsRead: 200, ReadTime: 30,
+				WritesCompleted: 400, WritesMerged: 5, SectorsWritten: 600, WriteTime: 70,
+				IOInProgress: 1, IOTime: 80, WeightedIOTime: 100,
+				DiscardsCompleted: 10, SectorsDiscarded: 2048, DiscardTime: 5,
+				FlushCompleted: 300, FlushTime: 40},
+			{Major: 253, Minor: 1, DeviceName: "vda1",
+				ReadsCompleted: 90, ReadsMerged: 1, SectorsRead: 180, ReadTime: 25,
+				WritesCompleted: 390, WritesMerged: 5, SectorsWritten: 590, WriteTime: 65,
+				IOTime: 75, WeightedIOTime: 90,
+				DiscardsCompleted: 10, SectorsDiscarded: 2048, DiscardTime: 5},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.root, func(t *testing.T) {
+			c := newTestCollector(tc.root)
+			got, ok := c.readDiskStats(nil, nil)
+			if !ok {
+				t.Fatalf("failed: %v", c.result.System.Warnings)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if len(c.result.System.Warnings) > 0 {
+				t.Errorf("unexpected warnings: %v", c.result.System.Warnings)
+			}
+		})
+	}
+}
+
+func TestTrimPartition(t *testing.T) {
+	cases := []struct {
+		name, want string
+	}{
+		{"sda", "sda"},
+		{"sda1", "sda"},
+		{"sdab12", "sdab"},
+		{"vdb2", "vdb"},
+		{"xvda1", "xvda"},
+		{"hdc3", "hdc"},
+		{"nvme0n1", "nvme0n1"},
+		{"nvme0n1p1", "nvme0n1"},
+		{"nvme10n2p15", "nvme10n2"},
+		{"mmcblk0", "mmcblk0"},
+		{"mmcblk0p2", "mmcblk0"},
+		{"dm-0", "dm-0"},
+		{"md0", "md0"},
+		{"md127", "md127"},
+		{"loop3", "loop3"},
+		{"sd1", "sd1"},
+		{"cciss!c0d0", "cciss!c0d0"},
+		{"cciss!c0d0p1", "cciss!c0d0"},
+	}
+	for _, tc := range cases {
+		if got := trimPartition(tc.name); got != tc.want {
+			t.Errorf("trimPartition(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestActiveScheduler(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"none [mq-deadline] kyber bfq\n", "mq-deadline"},
+		{"[none] mq-deadline\n", "none"},
+		{"noop deadline [cfq]", "cfq"},
+		{"none\n", "none"},
+		{"", ""},
+		{"none [broken", "none [broken"},
+	}
+	for _, tc := range cases {
+		if got := activeScheduler(tc.in); got != tc.want {
+			t.Errorf("activeScheduler(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -16,6 +16,22 @@
 
 package collector
 
+import (
+	"errors"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
 func (c *collector) collectSystem(o CollectConfig) {
 	// Not implemented for windows yet.
 }
+
+// statfs is not implemented for windows yet.
+func statfs(path string) (pgmetrics.DiskUsage, error) {
+	return pgmetrics.DiskUsage{}, errors.New("not implemented for windows yet")
+}
+
+// deviceOf is not implemented for windows yet.
+func deviceOf(path string) (uint64, error) {
+	return 0, errors.New("not implemented for windows yet")
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgmetrics
+
+import "math"
+
+// sectorSize is the unit in which /proc/diskstats reports sectors read and
+// written, irrespective of the actual sector size of the device.
+const sectorSize = 512
+
+// ModelDelta contains rates derived from the monotonically increasing
+// counters of two Model snapshots. See ComputeDelta.
+type ModelDelta struct {
+	ElapsedSeconds float64          `json:"elapsed_seconds"` // time between the two snapshots
+	DiskStats      []DiskStatsDelta `json:"diskstats,omitempty"`
+}
+
+// DiskStatsDelta contains the I/O rates of a single block device, computed
+// from the difference between two DiskStats samples.
+type DiskStatsDelta struct {
+	Major            int     `json:"major"`               // major number
+	Minor            int     `json:"minor"`               // minor number
+	DeviceName       string  `json:"device_name"`         // device name
+	ReadsPerSec      float64 `json:"reads_per_sec"`       // reads completed per second
+	WritesPerSec     float64 `json:"writes_per_sec"`      // writes completed per second
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`  // bytes read per second
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"` // bytes written per second
+	ReadLatencyMs    float64 `json:"read_latency_ms"`     // average time per read (ms)
+	WriteLatencyMs   float64 `json:"write_latency_ms"`    // average time per write (ms)
+	Utilization      float64 `json:"utilization"`         // % of time with I/O in progress
+	AvgQueueSize     float64 `json:"avg_queue_size"`      // average number of I/Os in flight
+}
+
+// ComputeDelta computes rates from the counters present in two snapshots,
+// "before" and "after", of the same system. The elapsed time is taken from
+// the Metadata.At fields of the two snapshots.
+//
+// A counter that is smaller in "after" than in "before" is assumed to have
+// wrapped around or been reset, and its value in "after" is used as the
+// delta. Likewise, devices present in "after" but not in "before" are
+// included with their raw counter values as the delta. Devices present only
+// in "before" are omitted.
+//
+// Rates are left as zero if the elapsed time is not positive.
+func ComputeDelta(before, after *Model) *ModelDelta {
+	d := &ModelDelta{}
+	if before == nil || after == nil {
+		return d
+	}
+	d.ElapsedSeconds = float64(after.Metadata.At - before.Metadata.At)
+
+	if after.System == nil {
+		return d
+	}
+	prev := make(map[string]*DiskStats)
+	if before.System != nil {
+		for i := range before.System.DiskStats {
+			ds := &before.System.DiskStats[i]
+			prev[ds.DeviceName] = ds
+		}
+	}
+	for _, curr := range after.System.DiskStats {
+		var p DiskStats
+		if ds, ok := prev[curr.DeviceName]; ok {
+			p = *ds
+		}
+		d.DiskStats = append(d.DiskStats, DiskStatsRates(p, curr, d.ElapsedSeconds))
+	}
+	return d
+}
+
+// DiskStatsRates computes the I/O rates of a single block device from two
+// samples of its counters, taken elapsed seconds apart. Counters that went
+// backwards are handled as described in ComputeDelta, and the rates are left
+// as zero if elapsed is not positive.
+func DiskStatsRates(before, after DiskStats, elapsed float64) (out DiskStatsDelta) {
+	out.Major = after.Major
+	out.Minor = after.Minor
+	out.DeviceName = after.DeviceName
+	if elapsed <= 0 {
+		return
+	}
+
+	reads := CounterDelta(before.ReadsCompleted, after.ReadsCompleted)
+	writes := CounterDelta(before.WritesCompleted, after.WritesCompleted)
+	sectorsRead := CounterDelta(before.SectorsRead, after.SectorsRead)
+	sectorsWritten := CounterDelta(before.SectorsWritten, after.SectorsWritten)
+	readTime := CounterDelta(before.ReadTime, after.ReadTime)
+	writeTime := CounterDelta(before.WriteTime, after.WriteTime)
+
+	out.ReadsPerSec = float64(reads) / elapsed
+	out.WritesPerSec = float64(writes) / elapsed
+	out.ReadBytesPerSec = float64(sectorsRead*sectorSize) / elapsed
+	out.WriteBytesPerSec = float64(sectorsWritten*sectorSize) / elapsed
+	if reads > 0 {
+		out.ReadLatencyMs = float64(readTime) / float64(reads)
+	}
+	if writes > 0 {
+		out.WriteLatencyMs = float64(writeTime) / float64(writes)
+	}
+
+	// io_time is the ms the device had I/Os in flight, weighted_io_time the
+	// same multiplied by the number of I/Os in flight
+	elapsedMs := elapsed * 1000
+	out.Utilization = math.Min(100, float64(CounterDelta(before.IOTime, after.IOTime))*100/elapsedMs)
+	out.AvgQueueSize = float64(CounterDelta(before.WeightedIOTime, after.WeightedIOTime)) / elapsedMs
+	return
+}
+
+// CounterDelta returns the increase in a monotonic counter. If the counter
+// went backwards, it is assumed to have wrapped or been reset, and the
+// current value is returned.
+func CounterDelta(before, after int64) int64 {
+	if after < before {
+		return after
+	}
+	return after - before
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pgmetrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func snapshot(at int64, disks ...DiskStats) *Model {
+	return &Model{
+		Metadata: Metadata{At: at},
+		System:   &SystemMetrics{DiskStats: disks},
+	}
+}
+
+func TestComputeDelta(t *testing.T) {
+	sda := func(reads, sectors, readTime, ioTime int64) DiskStats {
+		return DiskStats{Major: 8, Minor: 0, DeviceName: "sda",
+			ReadsCompleted: reads, SectorsRead: sectors, ReadTime: readTime,
+			IOTime: ioTime}
+	}
+	cases := []struct {
+		name          string
+		before, after *Model
+		want          *ModelDelta
+	}{
+		{
+			name:   "increase",
+			before: snapshot(100, sda(1000, 8000, 500, 1000)),
+			after:  snapshot(110, sda(1100, 10048, 700, 6000)),
+			want: &ModelDelta{ElapsedSeconds: 10, DiskStats: []DiskStatsDelta{{
+				Major: 8, DeviceName: "sda", ReadsPerSec: 10,
+				ReadBytesPerSec: 2048 * 512 / 10.0, ReadLatencyMs: 2,
+				Utilization: 50,
+			}}},
+		},
+		{
+			name:   "counter wrapped",
+			before: snapshot(100, sda(1000, 8000, 500, 1000)),
+			after:  snapshot(110, sda(50, 400, 100, 2000)),
+			want: &ModelDelta{ElapsedSeconds: 10, DiskStats: []DiskStatsDelta{{
+				Major: 8, DeviceName: "sda", ReadsPerSec: 5,
+				ReadBytesPerSec: 400 * 512 / 10, ReadLatencyMs: 2,
+				Utilization: 10,
+			}}},
+		},
+		{
+			name:   "device only in after",
+			before: snapshot(100),
+			after:  snapshot(110, sda(100, 200, 300, 400)),
+			want: &ModelDelta{ElapsedSeconds: 10, DiskStats: []DiskStatsDelta{{
+				Major: 8, DeviceName: "sda", ReadsPerSec: 10,
+				ReadBytesPerSec: 200 * 512 / 10, ReadLatencyMs: 3,
+				Utilization: 4,
+			}}},
+		},
+		{
+			name:   "device only in before",
+			before: snapshot(100, sda(100, 200, 300, 400)),
+			after:  snapshot(110),
+			want:   &ModelDelta{ElapsedSeconds: 10},
+		},
+		{
+			name:   "zero elapsed",
+			before: snapshot(100, sda(1000, 8000, 500, 1000)),
+			after:  snapshot(100, sda(1100, 10048, 700, 6000)),
+			want: &ModelDelta{DiskStats: []DiskStatsDelta{{
+				Major: 8, DeviceName: "sda",
+			}}},
+		},
+		{
+			name:   "negative elapsed",
+			before: snapshot(110, sda(1000, 8000, 500, 1000)),
+			after:  snapshot(100, sda(1100, 10048, 700, 6000)),
+			want: &ModelDelta{ElapsedSeconds: -10, DiskStats: []DiskStatsDelta{{
+				Major: 8, DeviceName: "sda",
+			}}},
+		},
+		{
+			name:   "nil snapshot",
+			before: nil,
+			after:  snapshot(110, sda(1100, 10048, 700, 6000)),
+			want:   &ModelDelta{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ComputeDelta(tc.before, tc.after); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	cases := []struct{ before, after, want int64 }{
+		{10, 25, 15},
+		{25, 25, 0},
+		{25, 10, 10}, // wrapped or reset
+	}
+	for _, tc := range cases {
+		if got := CounterDelta(tc.before, tc.after); got != tc.want {
+			t.Errorf("CounterDelta(%d, %d) = %d, want %d", tc.before, tc.after, got, tc.want)
+		}
+	}
+}
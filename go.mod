@@ -8,6 +8,7 @@ require (
 	github.com/jackc/pgx/v5 v5.7.6
 	github.com/pborman/getopt v1.1.0
 	golang.org/x/mod v0.28.0
+	golang.org/x/sys v0.36.0
 	golang.org/x/term v0.35.0
 )
 
@@ -26,7 +27,6 @@ require (
 	golang.org/x/crypto v0.42.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
-	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 )
 
@@ -16,9 +16,19 @@
 
 package pgmetrics
 
+import "encoding/json"
+
 // ModelSchemaVersion is the schema version of the "Model" data structure
 // defined below. It is in the "semver" notation. Version history:
 //
+//	1.22 - Kernel IPC limits, postmaster fd count, cgroup limits (linux),
+//				data and WAL directory disk usage, postmaster process stats,
+//				system collection warnings, disk I/O rates, NUMA topology,
+//				kernel and OS versions, available and reserved disk space,
+//				socket usage, temperature sensors, postmaster fd limits,
+//				block device queue settings, paging counters and rates,
+//				streaming output (ModelSection), tablespace mount points,
+//				WAL retained by replication slots
 //	1.21 - hint_plan.hints table support
 //	1.20 - Disk I/O statistics from /proc/diskstats
 //	1.19 - Postgres 18 support
@@ -42,7 +52,7 @@ package pgmetrics
 //	1.2 - more table and index attributes
 //	1.1 - added NotificationQueueUsage and Statements
 //	1.0 - initial release
-const ModelSchemaVersion = "1.21"
+const ModelSchemaVersion = "1.22"
 
 // Model contains the entire information collected by a single run of
 // pgmetrics. It can be converted to and from json without loss of
@@ -204,6 +214,46 @@ type Model struct {
 
 	// value of pg_conf_load_time() as seconds since epoch
 	ConfLoadTime int64 `json:"conf_load_time,omitempty"`
+
+	// following fields are present only in schema 1.22 and later
+
+	// disk usage of the filesystems containing the data directory and the
+	// WAL directory (pg_wal, or pg_xlog before v10), present only if local
+	DataDirDisk *DiskUsage `json:"datadir_disk,omitempty"`
+	WALDirDisk  *DiskUsage `json:"waldir_disk,omitempty"`
+
+	// file descriptor limits and memory usage of the postmaster, present only
+	// if local and on Linux
+	PostgresProcess *PostgreSQLProcessInfo `json:"postgres_process,omitempty"`
+
+	// WAL retained by replication slots, present only if there are slots
+	WALRetention *WALRetention `json:"wal_retention,omitempty"`
+}
+
+// ModelSection is a part of a Model, as written by the collector in streaming
+// mode, one JSON object per line. The sections, in the order they are
+// written, are:
+//
+//   - "cluster": a Model with the cluster-level information
+//   - "system": the SystemMetrics, if collected
+//   - "tables", "indexes", "sequences", "user_functions", "extensions",
+//     "disabled_triggers", "hints", "publications" and "subscriptions": a
+//     JSON array with the objects of that type from the database DBName, for
+//     each database in turn, omitted if there are none
+//   - "end": a Model with only the top-level fields that were collected or
+//     changed after the "cluster" and "system" sections were written (like
+//     the logs, the statements and the RDS or Azure metrics), and without
+//     the database-specific arrays listed above; in pgbouncer and pgpool
+//     modes, which have no "cluster" section, this is the whole Model
+//
+// Decoding the "cluster" Data and then the "end" Data into the same Model
+// gives everything except the "system" section and the database-specific
+// arrays. A stream without an "end" section is incomplete. Added in schema
+// 1.22.
+type ModelSection struct {
+	Section string          `json:"section"`
+	DBName  string          `json:"db_name,omitempty"` // only for database-specific sections
+	Data    json.RawMessage `json:"data"`
 }
 
 // DatabaseByOID iterates over the databases in the model and returns the reference
@@ -301,30 +351,132 @@ type SystemMetrics struct {
 	MemSlab int64 `json:"memslab"` // RAM used for slab in bytes
 	// following fields present only in schema 1.20 and later
 	DiskStats []DiskStats `json:"diskstats,omitempty"` // disk I/O statistics from /proc/diskstats
+	// following fields present only in schema 1.22 and later
+	ShmMax            int64     `json:"shmmax,omitempty"`              // kernel.shmmax, in bytes
+	ShmAll            int64     `json:"shmall,omitempty"`              // kernel.shmall, in pages
+	ShmMni            int64     `json:"shmmni,omitempty"`              // kernel.shmmni
+	SemParams         *[4]int64 `json:"sem,omitempty"`                 // kernel.sem: SEMMSL, SEMMNS, SEMOPM, SEMMNI; nil if not collected
+	FileMax           int64     `json:"file_max,omitempty"`            // fs.file-max
+	PostmasterFDCount int64     `json:"postmaster_fd_count,omitempty"` // open fds of the postmaster, 0 if not accessible
+	CgroupMemLimit    int64     `json:"cgroup_mem_limit,omitempty"`    // memory limit of the postmaster's cgroup in bytes, 0 if none
+	CgroupMemUsed     int64     `json:"cgroup_mem_used,omitempty"`     // memory used by the postmaster's cgroup in bytes
+	CgroupCPULimit    float64   `json:"cgroup_cpu_limit,omitempty"`    // cpu quota/period of the postmaster's cgroup, as #cores, 0 if none
+	// resource usage of the postmaster, and of all its children put together
+	Postmaster         *ProcessStats `json:"postmaster,omitempty"`
+	PostmasterChildren *ProcessStats `json:"postmaster_children,omitempty"`
+	// paging counters from /proc/vmstat, and the swapping rates if sampled
+	// twice (see CollectConfig.DiskSampleInterval)
+	PgMajFault  int64   `json:"pgmajfault,omitempty"`    // major page faults
+	PSwpIn      int64   `json:"pswpin,omitempty"`        // pages swapped in
+	PSwpOut     int64   `json:"pswpout,omitempty"`       // pages swapped out
+	SwapInRate  float64 `json:"swap_in_rate,omitempty"`  // pages swapped in per second
+	SwapOutRate float64 `json:"swap_out_rate,omitempty"` // pages swapped out per second
+	// NUMA nodes, empty if the kernel does not expose a NUMA topology
+	NUMANodes []NUMANodeStats `json:"numa_nodes,omitempty"`
+	// kernel and distribution, as reported by the OS
+	KernelRelease string `json:"kernel_release,omitempty"` // uname -r, like "5.10.68-62.173.amzn2.x86_64"
+	KernelVersion string `json:"kernel_version,omitempty"` // uname -v, like "#1 SMP Tue Sep 28 18:05:31 UTC 2021"
+	Machine       string `json:"machine,omitempty"`        // uname -m, like "x86_64"
+	OSName        string `json:"os_name,omitempty"`        // distribution name, like "Amazon Linux 2"
+	OSVersion     string `json:"os_version,omitempty"`     // distribution version, like "2"
+	// socket usage and ephemeral port range
+	TCPStats *TCPStats `json:"tcp_stats,omitempty"`
+	// temperature sensors, empty if there are none (as in most VMs)
+	Sensors []Sensor `json:"sensors,omitempty"`
+	// problems encountered while collecting the above, if any
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ProcessStats contains the resource usage of one or more OS processes,
+// from /proc/[pid]/stat, /proc/[pid]/status and /proc/[pid]/fd. When
+// aggregated over many processes, the memory values will count shared memory
+// (like shared_buffers) multiple times. Added in schema 1.22.
+type ProcessStats struct {
+	NumProcesses int   `json:"num_processes"` // number of processes aggregated
+	RSS          int64 `json:"rss"`           // resident set size, in bytes
+	VSize        int64 `json:"vsize"`         // virtual memory size, in bytes
+	UserCPU      int64 `json:"user_cpu"`      // time spent in user mode, in clock ticks
+	SystemCPU    int64 `json:"system_cpu"`    // time spent in kernel mode, in clock ticks
+	NumThreads   int64 `json:"num_threads"`   // number of threads
+	NumFDs       int64 `json:"num_fds"`       // open file descriptors, 0 if not accessible
+}
+
+// NUMANodeStats contains the CPUs and memory of a single NUMA node, from
+// /sys/devices/system/node/nodeN. Added in schema 1.22.
+type NUMANodeStats struct {
+	NodeID         int   `json:"node_id"`         // N in nodeN
+	CPUs           []int `json:"cpus"`            // CPUs on this node
+	MemTotalBytes  int64 `json:"mem_total_bytes"` // total RAM on this node, in bytes
+	MemFreeBytes   int64 `json:"mem_free_bytes"`  // free RAM on this node, in bytes
+	MemUsedBytes   int64 `json:"mem_used_bytes"`  // used RAM on this node, in bytes
+	HugePagesTotal int64 `json:"hugepages_total"` // number of huge pages allocated on this node
+}
+
+// TCPStats contains the number of sockets in use, from /proc/net/sockstat and
+// /proc/net/sockstat6, and the range of local ports available for outgoing
+// connections. Added in schema 1.22.
+type TCPStats struct {
+	TCPInUse         int64 `json:"tcp_inuse"`          // TCP sockets in use (IPv4)
+	TCPOrphan        int64 `json:"tcp_orphan"`         // orphaned TCP sockets
+	TCPTimewait      int64 `json:"tcp_timewait"`       // TCP sockets in TIME_WAIT
+	TCPAlloc         int64 `json:"tcp_alloc"`          // TCP sockets allocated
+	TCPMem           int64 `json:"tcp_mem"`            // memory used by TCP sockets, in pages
+	UDPInUse         int64 `json:"udp_inuse"`          // UDP sockets in use (IPv4)
+	TCP6InUse        int64 `json:"tcp6_inuse"`         // TCP sockets in use (IPv6)
+	UDP6InUse        int64 `json:"udp6_inuse"`         // UDP sockets in use (IPv6)
+	EphemeralPortMin int   `json:"ephemeral_port_min"` // net.ipv4.ip_local_port_range, lower bound
+	EphemeralPortMax int   `json:"ephemeral_port_max"` // net.ipv4.ip_local_port_range, upper bound
+}
+
+// Sensor is a temperature sensor, from /sys/class/hwmon. Added in schema 1.22.
+type Sensor struct {
+	Device      string  `json:"device"`       // hwmon device, like "hwmon3"
+	ID          string  `json:"id"`           // sensor within the device, like "temp2"
+	Name        string  `json:"name"`         // name of the chip, like "coretemp"
+	Label       string  `json:"label"`        // name of the sensor, like "Core 0"
+	TempCelsius float64 `json:"temp_celsius"` // current temperature
+	CritCelsius float64 `json:"crit_celsius"` // critical temperature, 0 if not known
 }
 
 // DiskStats represents disk I/O statistics from /proc/diskstats
 type DiskStats struct {
-	Major           int    `json:"major"`            // major number
-	Minor           int    `json:"minor"`            // minor number
-	DeviceName      string `json:"device_name"`      // device name
-	ReadsCompleted  int64  `json:"reads_completed"`  // reads completed successfully
-	ReadsMerged     int64  `json:"reads_merged"`     // reads merged
-	SectorsRead     int64  `json:"sectors_read"`     // sectors read
-	ReadTime        int64  `json:"read_time"`        // time spent reading (ms)
-	WritesCompleted int64  `json:"writes_completed"` // writes completed
-	WritesMerged    int64  `json:"writes_merged"`    // writes merged
-	SectorsWritten  int64  `json:"sectors_written"`  // sectors written
-	WriteTime       int64  `json:"write_time"`       // time spent writing (ms)
-	IOInProgress    int64  `json:"io_in_progress"`   // I/Os currently in progress
-	IOTime          int64  `json:"io_time"`          // time spent doing I/Os (ms)
-	WeightedIOTime  int64  `json:"weighted_io_time"` // weighted time spent doing I/Os (ms)
-	DiscardsCompleted int64 `json:"discards_completed"` // discards completed successfully
-	DiscardsMerged  int64  `json:"discards_merged"`  // discards merged
-	SectorsDiscarded int64 `json:"sectors_discarded"` // sectors discarded
-	DiscardTime     int64  `json:"discard_time"`     // time spent discarding (ms)
-	FlushCompleted  int64  `json:"flush_completed"`  // flush requests completed successfully
-	FlushTime       int64  `json:"flush_time"`       // time spent flushing (ms)
+	Major             int    `json:"major"`              // major number
+	Minor             int    `json:"minor"`              // minor number
+	DeviceName        string `json:"device_name"`        // device name
+	ReadsCompleted    int64  `json:"reads_completed"`    // reads completed successfully
+	ReadsMerged       int64  `json:"reads_merged"`       // reads merged
+	SectorsRead       int64  `json:"sectors_read"`       // sectors read
+	ReadTime          int64  `json:"read_time"`          // time spent reading (ms)
+	WritesCompleted   int64  `json:"writes_completed"`   // writes completed
+	WritesMerged      int64  `json:"writes_merged"`      // writes merged
+	SectorsWritten    int64  `json:"sectors_written"`    // sectors written
+	WriteTime         int64  `json:"write_time"`         // time spent writing (ms)
+	IOInProgress      int64  `json:"io_in_progress"`     // I/Os currently in progress
+	IOTime            int64  `json:"io_time"`            // time spent doing I/Os (ms)
+	WeightedIOTime    int64  `json:"weighted_io_time"`   // weighted time spent doing I/Os (ms)
+	DiscardsCompleted int64  `json:"discards_completed"` // discards completed successfully
+	DiscardsMerged    int64  `json:"discards_merged"`    // discards merged
+	SectorsDiscarded  int64  `json:"sectors_discarded"`  // sectors discarded
+	DiscardTime       int64  `json:"discard_time"`       // time spent discarding (ms)
+	FlushCompleted    int64  `json:"flush_completed"`    // flush requests completed successfully
+	FlushTime         int64  `json:"flush_time"`         // time spent flushing (ms)
+
+	// following fields present only in schema 1.22 and later, and only if
+	// the disk stats were sampled twice (see CollectConfig.DiskSampleInterval)
+	SampleSeconds    float64 `json:"sample_seconds,omitempty"`      // time between the two samples
+	ReadsPerSec      float64 `json:"reads_per_sec,omitempty"`       // reads completed per second
+	WritesPerSec     float64 `json:"writes_per_sec,omitempty"`      // writes completed per second
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec,omitempty"`  // bytes read per second
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec,omitempty"` // bytes written per second
+	Utilization      float64 `json:"utilization,omitempty"`         // % of time the device was busy
+	AvgQueueSize     float64 `json:"avg_queue_size,omitempty"`      // average number of I/Os in flight
+
+	// following fields present only in schema 1.22 and later, from
+	// /sys/block/<dev>/queue (of the parent device, for partitions)
+	Scheduler   string `json:"scheduler,omitempty"`     // active I/O scheduler, like "mq-deadline"
+	QueueDepth  int64  `json:"queue_depth,omitempty"`   // nr_requests
+	ReadAheadKB int64  `json:"read_ahead_kb,omitempty"` // read_ahead_kb
+	Rotational  *bool  `json:"rotational,omitempty"`    // true for spinning disks, nil if not known
 }
 
 type Backend struct {
@@ -364,6 +516,20 @@ type ReplicationSlot struct {
 	TwoPhase    bool   `json:"two_phase,omitempty"`     // >= pg14
 	// following fields present only in schema 1.16 and later
 	Conflicting bool `json:"conflicting,omitempty"` // >= pg16
+	// following fields present only in schema 1.22 and later
+	RetainedWALBytes int64 `json:"retained_wal_bytes,omitempty"` // WAL kept since restart_lsn, in bytes
+}
+
+// WALRetention is the WAL that the replication slots are keeping from being
+// removed, and whether it puts the WAL directory's filesystem at risk of
+// filling up. Added in schema 1.22.
+type WALRetention struct {
+	// sum of RetainedWALBytes of all replication slots
+	TotalRetainedWALBytes int64 `json:"total_retained_wal_bytes"`
+	// true if replication slots are retaining WAL and WALDirDisk.DiskUsed,
+	// which already includes the retained WAL, is more than 80% of
+	// WALDirDisk.DiskTotal; valid only if local
+	WALDiskPressure bool `json:"wal_disk_pressure"`
 }
 
 type Role struct {
@@ -391,6 +557,42 @@ type Tablespace struct {
 	DiskTotal   int64  `json:"disk_total"`
 	InodesUsed  int64  `json:"inodes_used"`
 	InodesTotal int64  `json:"inodes_total"`
+	// following fields present only in schema 1.22 and later
+	DiskAvailable int64 `json:"disk_available"` // space usable by unprivileged users, in bytes
+	DiskReserved  int64 `json:"disk_reserved"`  // free space reserved for root, in bytes
+	// the filesystem the tablespace is in, and if any other tablespace is in
+	// the same one, in which case the Disk* and Inodes* values are the same
+	// for all of them, and should be counted only once
+	MountPoint    string `json:"mount_point,omitempty"`
+	SharesStorage bool   `json:"shares_storage,omitempty"`
+}
+
+// DiskUsage contains the space and inode usage of the filesystem containing
+// a directory. Added in schema 1.22.
+type DiskUsage struct {
+	Path        string `json:"path"` // the directory, with symlinks resolved
+	DiskUsed    int64  `json:"disk_used"`
+	DiskTotal   int64  `json:"disk_total"`
+	InodesUsed  int64  `json:"inodes_used"`
+	InodesTotal int64  `json:"inodes_total"`
+	// DiskTotal - DiskUsed is the free space, which includes the space that
+	// is reserved for root and not available to postgres
+	DiskAvailable int64 `json:"disk_available"` // space usable by unprivileged users, in bytes
+	DiskReserved  int64 `json:"disk_reserved"`  // free space reserved for root, in bytes
+}
+
+// PostgreSQLProcessInfo contains the open file limits and the usage of the
+// postmaster process, from /proc/[pid]/limits, /proc/[pid]/fdinfo and
+// /proc/[pid]/status. Added in schema 1.22.
+type PostgreSQLProcessInfo struct {
+	PostmasterPID         int   `json:"postmaster_pid"`           // from postmaster.pid
+	PostmasterFDSoftLimit int64 `json:"postmaster_fd_soft_limit"` // "Max open files" soft limit, -1 if unlimited
+	PostmasterFDHardLimit int64 `json:"postmaster_fd_hard_limit"` // "Max open files" hard limit, -1 if unlimited
+	PostmasterFDCurrent   int64 `json:"postmaster_fd_current"`    // open file descriptors, same as SystemMetrics.PostmasterFDCount
+	VmPeak                int64 `json:"vm_peak"`                  // peak virtual memory size, in bytes
+	VmRSS                 int64 `json:"vm_rss"`                   // resident set size, in bytes
+	VmSwap                int64 `json:"vm_swap"`                  // swapped-out memory, in bytes
+	Threads               int64 `json:"threads"`                  // number of threads
 }
 
 type Database struct {
@@ -0,0 +1,520 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheus converts the information collected by pgmetrics into
+// the Prometheus text exposition format.
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// ContentType is the HTTP Content-Type of the output of WritePrometheus.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes the metrics in the model to w, in the Prometheus text
+// exposition format (version 0.0.4). The output is suitable for the textfile
+// collector of the Prometheus node exporter. All metric names are prefixed
+// with "pgmetrics_". Sections of the model that are absent do not produce any
+// metrics.
+func WritePrometheus(w io.Writer, m *pgmetrics.Model) error {
+	var e exposition
+	e.addMeta(m)
+	e.addCluster(m)
+	e.addDatabases(m)
+	e.addTablespaces(m)
+	e.addTables(m)
+	e.addReplicationSlots(m)
+	if m.System != nil {
+		e.addSystem(m)
+	}
+	return e.write(w)
+}
+
+//------------------------------------------------------------------------------
+// the model
+
+func (e *exposition) addMeta(m *pgmetrics.Model) {
+	e.gauge("info", "Information about the pgmetrics run.", 1,
+		"version", m.Metadata.Version,
+		"user_agent", m.Metadata.UserAgent,
+		"mode", m.Metadata.Mode)
+	e.gauge("collected_at_seconds", "Time the collection was started, as seconds since epoch.",
+		float64(m.Metadata.At))
+}
+
+func (e *exposition) addCluster(m *pgmetrics.Model) {
+	if m.Metadata.Mode != "" && m.Metadata.Mode != "postgres" {
+		return
+	}
+	e.gauge("postgres_start_time_seconds", "Time the postmaster was started, as seconds since epoch.",
+		float64(m.StartTime))
+	e.gauge("postgres_in_recovery", "Whether the server is in recovery (1) or not (0).",
+		b2f(m.IsInRecovery))
+	e.gauge("postgres_wal_files", "Number of WAL files in the WAL directory.",
+		float64(m.WALCount))
+	e.gauge("postgres_wal_ready_files", "Number of WAL files ready to be archived.",
+		float64(m.WALReadyCount))
+	e.gauge("postgres_notification_queue_usage", "Fraction of the asynchronous notification queue in use.",
+		m.NotificationQueueUsage)
+	e.counter("postgres_wal_archived_total", "Number of WAL files archived successfully.",
+		float64(m.WALArchiving.ArchivedCount))
+	e.counter("postgres_wal_archive_failed_total", "Number of failed attempts to archive WAL files.",
+		float64(m.WALArchiving.FailedCount))
+
+	// backends, by database and state
+	type dbState struct{ db, state string }
+	var keys []dbState
+	counts := make(map[dbState]int)
+	for _, b := range m.Backends {
+		k := dbState{b.DBName, b.State}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	for _, k := range keys {
+		e.gauge("postgres_backends", "Number of backends, by database and state.",
+			float64(counts[k]), "database", k.db, "state", k.state)
+	}
+
+	bg := m.BGWriter
+	e.counter("postgres_bgwriter_buffers_clean_total", "Buffers written by the background writer.",
+		float64(bg.BuffersClean))
+	e.counter("postgres_bgwriter_maxwritten_clean_total", "Times the background writer stopped a cleaning scan because it had written too many buffers.",
+		float64(bg.MaxWrittenClean))
+	e.counter("postgres_bgwriter_buffers_alloc_total", "Buffers allocated.",
+		float64(bg.BuffersAlloc))
+
+	if w := m.WAL; w != nil {
+		e.counter("postgres_wal_records_total", "WAL records generated.", float64(w.Records))
+		e.counter("postgres_wal_fpi_total", "WAL full page images generated.", float64(w.FPI))
+		e.counter("postgres_wal_bytes_total", "WAL generated, in bytes.", float64(w.Bytes))
+		e.counter("postgres_wal_buffers_full_total", "Times WAL data was written to disk because WAL buffers were full.",
+			float64(w.BuffersFull))
+	}
+}
+
+func (e *exposition) addDatabases(m *pgmetrics.Model) {
+	for _, d := range m.Databases {
+		l := []string{"database", d.Name}
+		e.gauge("database_backends", "Number of backends connected to the database.", float64(d.NumBackends), l...)
+		e.gauge("database_frozenxid_age", "Age of the database's datfrozenxid.", float64(d.AgeDatFrozenXid), l...)
+		if d.Size != -1 {
+			e.gauge("database_size_bytes", "Size of the database, in bytes.", float64(d.Size), l...)
+		}
+		e.counter("database_xact_commit_total", "Transactions committed.", float64(d.XactCommit), l...)
+		e.counter("database_xact_rollback_total", "Transactions rolled back.", float64(d.XactRollback), l...)
+		e.counter("database_blks_read_total", "Disk blocks read.", float64(d.BlksRead), l...)
+		e.counter("database_blks_hit_total", "Disk blocks found in the buffer cache.", float64(d.BlksHit), l...)
+		e.counter("database_tup_returned_total", "Rows returned by queries.", float64(d.TupReturned), l...)
+		e.counter("database_tup_fetched_total", "Rows fetched by queries.", float64(d.TupFetched), l...)
+		e.counter("database_tup_inserted_total", "Rows inserted.", float64(d.TupInserted), l...)
+		e.counter("database_tup_updated_total", "Rows updated.", float64(d.TupUpdated), l...)
+		e.counter("database_tup_deleted_total", "Rows deleted.", float64(d.TupDeleted), l...)
+		e.counter("database_conflicts_total", "Queries cancelled due to conflicts with recovery.", float64(d.Conflicts), l...)
+		e.counter("database_temp_files_total", "Temporary files created.", float64(d.TempFiles), l...)
+		e.counter("database_temp_bytes_total", "Data written to temporary files, in bytes.", float64(d.TempBytes), l...)
+		e.counter("database_deadlocks_total", "Deadlocks detected.", float64(d.Deadlocks), l...)
+		e.counter("database_blk_read_time_seconds_total", "Time spent reading data file blocks.", d.BlkReadTime/1000, l...)
+		e.counter("database_blk_write_time_seconds_total", "Time spent writing data file blocks.", d.BlkWriteTime/1000, l...)
+	}
+}
+
+func (e *exposition) addTablespaces(m *pgmetrics.Model) {
+	for _, t := range m.Tablespaces {
+		l := []string{"tablespace", t.Name}
+		if t.Size != -1 {
+			e.gauge("tablespace_size_bytes", "Size of the tablespace, in bytes.", float64(t.Size), l...)
+		}
+		if t.MountPoint != "" {
+			e.gauge("tablespace_mount_info", "Mount point of the filesystem containing the tablespace, and whether other tablespaces share it.",
+				1, append(l, "mount_point", t.MountPoint, "shares_storage", strconv.FormatBool(t.SharesStorage))...)
+		}
+		if t.DiskTotal > 0 {
+			e.gauge("tablespace_disk_used_bytes", "Space used in the filesystem containing the tablespace, in bytes.",
+				float64(t.DiskUsed), l...)
+			e.gauge("tablespace_disk_total_bytes", "Size of the filesystem containing the tablespace, in bytes.",
+				float64(t.DiskTotal), l...)
+			e.gauge("tablespace_disk_available_bytes", "Space available to unprivileged users in the filesystem containing the tablespace, in bytes.",
+				float64(t.DiskAvailable), l...)
+			e.gauge("tablespace_disk_reserved_bytes", "Free space reserved for root in the filesystem containing the tablespace, in bytes.",
+				float64(t.DiskReserved), l...)
+		}
+		if t.InodesTotal > 0 {
+			e.gauge("tablespace_inodes_used", "Inodes used in the filesystem containing the tablespace.",
+				float64(t.InodesUsed), l...)
+			e.gauge("tablespace_inodes_total", "Inodes in the filesystem containing the tablespace.",
+				float64(t.InodesTotal), l...)
+		}
+	}
+}
+
+func (e *exposition) addTables(m *pgmetrics.Model) {
+	for _, t := range m.Tables {
+		l := []string{"database", t.DBName, "schema", t.SchemaName, "table", t.Name}
+		e.counter("table_seq_scan_total", "Sequential scans on the table.", float64(t.SeqScan), l...)
+		e.counter("table_seq_tup_read_total", "Rows fetched by sequential scans.", float64(t.SeqTupRead), l...)
+		e.counter("table_idx_scan_total", "Index scans on the table.", float64(t.IdxScan), l...)
+		e.counter("table_idx_tup_fetch_total", "Rows fetched by index scans.", float64(t.IdxTupFetch), l...)
+		e.counter("table_n_tup_ins_total", "Rows inserted.", float64(t.NTupIns), l...)
+		e.counter("table_n_tup_upd_total", "Rows updated.", float64(t.NTupUpd), l...)
+		e.counter("table_n_tup_del_total", "Rows deleted.", float64(t.NTupDel), l...)
+		e.counter("table_n_tup_hot_upd_total", "Rows HOT updated.", float64(t.NTupHotUpd), l...)
+		e.gauge("table_n_live_tup", "Estimated number of live rows.", float64(t.NLiveTup), l...)
+		e.gauge("table_n_dead_tup", "Estimated number of dead rows.", float64(t.NDeadTup), l...)
+		e.counter("table_vacuum_count_total", "Times the table was vacuumed manually.", float64(t.VacuumCount), l...)
+		e.counter("table_autovacuum_count_total", "Times the table was vacuumed by autovacuum.", float64(t.AutovacuumCount), l...)
+		e.counter("table_analyze_count_total", "Times the table was analyzed manually.", float64(t.AnalyzeCount), l...)
+		e.counter("table_autoanalyze_count_total", "Times the table was analyzed by autovacuum.", float64(t.AutoanalyzeCount), l...)
+		e.counter("table_heap_blks_read_total", "Disk blocks read from the table.", float64(t.HeapBlksRead), l...)
+		e.counter("table_heap_blks_hit_total", "Buffer hits in the table.", float64(t.HeapBlksHit), l...)
+		if t.Size != -1 {
+			e.gauge("table_size_bytes", "Size of the table, in bytes.", float64(t.Size), l...)
+		}
+		if t.Bloat != -1 {
+			e.gauge("table_bloat_bytes", "Estimated bloat in the table, in bytes.", float64(t.Bloat), l...)
+		}
+		e.gauge("table_frozenxid_age", "Age of the table's relfrozenxid.", float64(t.AgeRelFrozenXid), l...)
+	}
+}
+
+func (e *exposition) addReplicationSlots(m *pgmetrics.Model) {
+	for _, rs := range m.ReplicationSlots {
+		l := []string{"slot", rs.SlotName, "slot_type", rs.SlotType, "database", rs.DBName}
+		e.gauge("replication_slot_active", "Whether the replication slot is active (1) or not (0).",
+			b2f(rs.Active), l...)
+		if rs.SafeWALSize != 0 {
+			e.gauge("replication_slot_safe_wal_size_bytes", "WAL that can be written before the slot is in danger of being lost, in bytes.",
+				float64(rs.SafeWALSize), l...)
+		}
+		e.gauge("replication_slot_retained_wal_bytes", "WAL retained by the replication slot, in bytes.",
+			float64(rs.RetainedWALBytes), l...)
+	}
+	if wr := m.WALRetention; wr != nil {
+		e.gauge("wal_retained_bytes", "WAL retained by all replication slots, in bytes.",
+			float64(wr.TotalRetainedWALBytes))
+		if m.Metadata.Local {
+			e.gauge("wal_disk_pressure", "Whether the WAL disk is over 80% full while replication slots are retaining WAL (1) or not (0).",
+				b2f(wr.WALDiskPressure))
+		}
+	}
+}
+
+func (e *exposition) addSystem(m *pgmetrics.Model) {
+	s := m.System
+	e.gauge("system_info", "Information about the system.", 1,
+		"hostname", s.Hostname, "cpu_model", s.CPUModel,
+		"kernel_release", s.KernelRelease, "kernel_version", s.KernelVersion,
+		"machine", s.Machine, "os_name", s.OSName, "os_version", s.OSVersion)
+	// not collected on all platforms (like macOS), where these are zero
+	if s.NumCores > 0 {
+		e.gauge("system_cpu_cores", "Number of CPU cores.", float64(s.NumCores))
+		e.gauge("system_load1", "1-minute load average.", s.LoadAvg)
+	}
+	if s.MemUsed > 0 || s.MemFree > 0 {
+		e.gauge("system_memory_used_bytes", "RAM used, in bytes.", float64(s.MemUsed))
+		e.gauge("system_memory_free_bytes", "RAM free, in bytes.", float64(s.MemFree))
+		e.gauge("system_memory_buffers_bytes", "RAM used for buffers, in bytes.", float64(s.MemBuffers))
+		e.gauge("system_memory_cached_bytes", "RAM used for cache, in bytes.", float64(s.MemCached))
+		e.gauge("system_memory_slab_bytes", "RAM used for slab, in bytes.", float64(s.MemSlab))
+		e.gauge("system_swap_used_bytes", "Swap used, in bytes.", float64(s.SwapUsed))
+		e.gauge("system_swap_free_bytes", "Swap free, in bytes.", float64(s.SwapFree))
+	}
+
+	if s.PgMajFault > 0 || s.PSwpIn > 0 || s.PSwpOut > 0 {
+		e.counter("system_pgmajfault_total", "Major page faults.", float64(s.PgMajFault))
+		e.counter("system_pswpin_total", "Pages swapped in.", float64(s.PSwpIn))
+		e.counter("system_pswpout_total", "Pages swapped out.", float64(s.PSwpOut))
+	}
+	if s.SwapInRate > 0 || s.SwapOutRate > 0 {
+		e.gauge("system_swap_in_pages_per_second", "Pages swapped in per second, over the sampling interval.", s.SwapInRate)
+		e.gauge("system_swap_out_pages_per_second", "Pages swapped out per second, over the sampling interval.", s.SwapOutRate)
+	}
+
+	// kernel limits
+	if s.ShmMax > 0 {
+		e.gauge("system_kernel_shmmax_bytes", "Value of kernel.shmmax.", float64(s.ShmMax))
+		e.gauge("system_kernel_shmall_pages", "Value of kernel.shmall.", float64(s.ShmAll))
+		e.gauge("system_kernel_shmmni", "Value of kernel.shmmni.", float64(s.ShmMni))
+	}
+	if s.SemParams != nil {
+		for i, name := range []string{"semmsl", "semmns", "semopm", "semmni"} {
+			e.gauge("system_kernel_"+name, "Value of "+strings.ToUpper(name)+" from kernel.sem.", float64(s.SemParams[i]))
+		}
+	}
+	if s.FileMax > 0 {
+		e.gauge("system_kernel_file_max", "Value of fs.file-max.", float64(s.FileMax))
+	}
+
+	// cgroup limits
+	if s.CgroupMemLimit > 0 {
+		e.gauge("system_cgroup_memory_limit_bytes", "Memory limit of the postmaster's cgroup, in bytes.", float64(s.CgroupMemLimit))
+		e.gauge("system_cgroup_memory_used_bytes", "Memory used by the postmaster's cgroup, in bytes.", float64(s.CgroupMemUsed))
+	}
+	if s.CgroupCPULimit > 0 {
+		e.gauge("system_cgroup_cpu_limit_cores", "CPU quota of the postmaster's cgroup, as number of cores.", s.CgroupCPULimit)
+	}
+
+	// postmaster and children
+	if s.PostmasterFDCount > 0 {
+		e.gauge("system_postmaster_fds", "Open file descriptors of the postmaster.", float64(s.PostmasterFDCount))
+	}
+	for _, p := range []struct {
+		which string
+		ps    *pgmetrics.ProcessStats
+	}{{"postmaster", s.Postmaster}, {"children", s.PostmasterChildren}} {
+		if p.ps == nil {
+			continue
+		}
+		e.gauge("system_process_count", "Number of processes.", float64(p.ps.NumProcesses), "process", p.which)
+		e.gauge("system_process_rss_bytes", "Resident set size, in bytes.", float64(p.ps.RSS), "process", p.which)
+		e.gauge("system_process_vsize_bytes", "Virtual memory size, in bytes.", float64(p.ps.VSize), "process", p.which)
+		e.counter("system_process_user_cpu_ticks_total", "CPU time spent in user mode, in clock ticks.", float64(p.ps.UserCPU), "process", p.which)
+		e.counter("system_process_system_cpu_ticks_total", "CPU time spent in kernel mode, in clock ticks.", float64(p.ps.SystemCPU), "process", p.which)
+		e.gauge("system_process_threads", "Number of threads.", float64(p.ps.NumThreads), "process", p.which)
+		if p.ps.NumFDs > 0 {
+			e.gauge("system_process_fds", "Open file descriptors.", float64(p.ps.NumFDs), "process", p.which)
+		}
+	}
+
+	// open file limits of the postmaster
+	if pp := m.PostgresProcess; pp != nil {
+		e.gauge("postmaster_fd_current", "Open file descriptors of the postmaster.", float64(pp.PostmasterFDCurrent))
+		if pp.PostmasterFDSoftLimit > 0 {
+			e.gauge("postmaster_fd_soft_limit", "Soft limit on open files of the postmaster.", float64(pp.PostmasterFDSoftLimit))
+		}
+		if pp.PostmasterFDHardLimit > 0 {
+			e.gauge("postmaster_fd_hard_limit", "Hard limit on open files of the postmaster.", float64(pp.PostmasterFDHardLimit))
+		}
+		e.gauge("postmaster_vm_peak_bytes", "Peak virtual memory size of the postmaster, in bytes.", float64(pp.VmPeak))
+		e.gauge("postmaster_vm_rss_bytes", "Resident set size of the postmaster, in bytes.", float64(pp.VmRSS))
+		e.gauge("postmaster_vm_swap_bytes", "Swapped-out memory of the postmaster, in bytes.", float64(pp.VmSwap))
+		e.gauge("postmaster_threads", "Threads in the postmaster.", float64(pp.Threads))
+	}
+
+	// NUMA nodes
+	for _, n := range s.NUMANodes {
+		l := []string{"node", strconv.Itoa(n.NodeID)}
+		e.gauge("system_numa_cpus", "Number of CPUs on the NUMA node.", float64(len(n.CPUs)), l...)
+		e.gauge("system_numa_memory_total_bytes", "Total RAM on the NUMA node, in bytes.", float64(n.MemTotalBytes), l...)
+		e.gauge("system_numa_memory_free_bytes", "Free RAM on the NUMA node, in bytes.", float64(n.MemFreeBytes), l...)
+		e.gauge("system_numa_memory_used_bytes", "Used RAM on the NUMA node, in bytes.", float64(n.MemUsedBytes), l...)
+		e.gauge("system_numa_hugepages_total", "Huge pages allocated on the NUMA node.", float64(n.HugePagesTotal), l...)
+	}
+
+	// sockets
+	if ts := s.TCPStats; ts != nil {
+		for _, v := range []struct {
+			proto, family string
+			n             int64
+		}{{"tcp", "ipv4", ts.TCPInUse}, {"tcp", "ipv6", ts.TCP6InUse}, {"udp", "ipv4", ts.UDPInUse}, {"udp", "ipv6", ts.UDP6InUse}} {
+			e.gauge("system_sockets_inuse", "Sockets in use.", float64(v.n), "proto", v.proto, "family", v.family)
+		}
+		e.gauge("system_tcp_orphan_sockets", "Orphaned TCP sockets.", float64(ts.TCPOrphan))
+		e.gauge("system_tcp_timewait_sockets", "TCP sockets in TIME_WAIT.", float64(ts.TCPTimewait))
+		e.gauge("system_tcp_alloc_sockets", "TCP sockets allocated.", float64(ts.TCPAlloc))
+		e.gauge("system_tcp_mem_pages", "Memory used by TCP sockets, in pages.", float64(ts.TCPMem))
+		if ts.EphemeralPortMax > 0 {
+			e.gauge("system_ephemeral_port_min", "Lower bound of the local port range.", float64(ts.EphemeralPortMin))
+			e.gauge("system_ephemeral_port_max", "Upper bound of the local port range.", float64(ts.EphemeralPortMax))
+		}
+	}
+
+	// temperature sensors
+	for _, sn := range s.Sensors {
+		l := []string{"device", sn.Device, "id", sn.ID, "chip", sn.Name, "sensor", sn.Label}
+		e.gauge("system_sensor_temp_celsius", "Current temperature of the sensor.", sn.TempCelsius, l...)
+		if sn.CritCelsius > 0 {
+			e.gauge("system_sensor_crit_celsius", "Critical temperature of the sensor.", sn.CritCelsius, l...)
+		}
+	}
+
+	// disk usage of data and WAL directories
+	for _, d := range []struct {
+		dir string
+		du  *pgmetrics.DiskUsage
+	}{{"data", m.DataDirDisk}, {"wal", m.WALDirDisk}} {
+		if d.du == nil || d.du.DiskTotal == 0 {
+			continue
+		}
+		l := []string{"dir", d.dir, "path", d.du.Path}
+		e.gauge("system_dir_disk_used_bytes", "Space used in the filesystem containing the directory, in bytes.", float64(d.du.DiskUsed), l...)
+		e.gauge("system_dir_disk_total_bytes", "Size of the filesystem containing the directory, in bytes.", float64(d.du.DiskTotal), l...)
+		e.gauge("system_dir_disk_available_bytes", "Space available to unprivileged users in the filesystem containing the directory, in bytes.", float64(d.du.DiskAvailable), l...)
+		e.gauge("system_dir_disk_reserved_bytes", "Free space reserved for root in the filesystem containing the directory, in bytes.", float64(d.du.DiskReserved), l...)
+		e.gauge("system_dir_inodes_used", "Inodes used in the filesystem containing the directory.", float64(d.du.InodesUsed), l...)
+		e.gauge("system_dir_inodes_total", "Inodes in the filesystem containing the directory.", float64(d.du.InodesTotal), l...)
+	}
+
+	// disk I/O
+	for _, ds := range s.DiskStats {
+		l := []string{"device", ds.DeviceName}
+		e.counter("disk_reads_completed_total", "Reads completed successfully.", float64(ds.ReadsCompleted), l...)
+		e.counter("disk_reads_merged_total", "Reads merged.", float64(ds.ReadsMerged), l...)
+		e.counter("disk_sectors_read_total", "Sectors read.", float64(ds.SectorsRead), l...)
+		e.counter("disk_read_time_seconds_total", "Time spent reading.", ms2s(ds.ReadTime), l...)
+		e.counter("disk_writes_completed_total", "Writes completed successfully.", float64(ds.WritesCompleted), l...)
+		e.counter("disk_writes_merged_total", "Writes merged.", float64(ds.WritesMerged), l...)
+		e.counter("disk_sectors_written_total", "Sectors written.", float64(ds.SectorsWritten), l...)
+		e.counter("disk_write_time_seconds_total", "Time spent writing.", ms2s(ds.WriteTime), l...)
+		e.gauge("disk_io_in_progress", "I/Os currently in progress.", float64(ds.IOInProgress), l...)
+		e.counter("disk_io_time_seconds_total", "Time spent doing I/Os.", ms2s(ds.IOTime), l...)
+		e.counter("disk_weighted_io_time_seconds_total", "Weighted time spent doing I/Os.", ms2s(ds.WeightedIOTime), l...)
+		e.counter("disk_discards_completed_total", "Discards completed successfully.", float64(ds.DiscardsCompleted), l...)
+		e.counter("disk_discards_merged_total", "Discards merged.", float64(ds.DiscardsMerged), l...)
+		e.counter("disk_sectors_discarded_total", "Sectors discarded.", float64(ds.SectorsDiscarded), l...)
+		e.counter("disk_discard_time_seconds_total", "Time spent discarding.", ms2s(ds.DiscardTime), l...)
+		e.counter("disk_flush_completed_total", "Flush requests completed successfully.", float64(ds.FlushCompleted), l...)
+		e.counter("disk_flush_time_seconds_total", "Time spent flushing.", ms2s(ds.FlushTime), l...)
+		if ds.Scheduler != "" {
+			e.gauge("disk_queue_info", "I/O scheduler of the device.", 1, "device", ds.DeviceName, "scheduler", ds.Scheduler)
+		}
+		if ds.QueueDepth > 0 {
+			e.gauge("disk_queue_depth", "Maximum number of requests in the queue of the device (nr_requests).", float64(ds.QueueDepth), l...)
+			e.gauge("disk_read_ahead_bytes", "Read-ahead size of the device, in bytes.", float64(ds.ReadAheadKB*1024), l...)
+		}
+		if ds.Rotational != nil {
+			e.gauge("disk_rotational", "Whether the device is a spinning disk (1) or not (0).", b2f(*ds.Rotational), l...)
+		}
+		if ds.SampleSeconds > 0 {
+			e.gauge("disk_reads_per_second", "Reads completed per second, over the sampling interval.", ds.ReadsPerSec, l...)
+			e.gauge("disk_writes_per_second", "Writes completed per second, over the sampling interval.", ds.WritesPerSec, l...)
+			e.gauge("disk_read_bytes_per_second", "Bytes read per second, over the sampling interval.", ds.ReadBytesPerSec, l...)
+			e.gauge("disk_write_bytes_per_second", "Bytes written per second, over the sampling interval.", ds.WriteBytesPerSec, l...)
+			e.gauge("disk_utilization_percent", "Percentage of the sampling interval the device was busy.", ds.Utilization, l...)
+			e.gauge("disk_avg_queue_size", "Average number of I/Os in flight, over the sampling interval.", ds.AvgQueueSize, l...)
+		}
+	}
+
+	e.gauge("system_warnings", "Number of problems encountered while collecting system metrics.",
+		float64(len(s.Warnings)))
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func ms2s(ms int64) float64 {
+	return float64(ms) / 1000
+}
+
+//------------------------------------------------------------------------------
+// the exposition format
+
+const prefix = "pgmetrics_"
+
+// exposition collects samples into metric families, so that the samples of
+// each family are written out together, in the order the families were first
+// seen.
+type exposition struct {
+	families []*family
+	byName   map[string]*family
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string // "counter" or "gauge"
+	samples []sample
+}
+
+type sample struct {
+	labels []string // name, value, name, value, ..
+	value  float64
+}
+
+func (e *exposition) gauge(name, help string, value float64, labels ...string) {
+	e.add(name, "gauge", help, value, labels)
+}
+
+func (e *exposition) counter(name, help string, value float64, labels ...string) {
+	e.add(name, "counter", help, value, labels)
+}
+
+func (e *exposition) add(name, typ, help string, value float64, labels []string) {
+	if e.byName == nil {
+		e.byName = make(map[string]*family)
+	}
+	f, ok := e.byName[name]
+	if !ok {
+		f = &family{name: prefix + name, help: help, typ: typ}
+		e.byName[name] = f
+		e.families = append(e.families, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (e *exposition) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range e.families {
+		bw.WriteString("# HELP ")
+		bw.WriteString(f.name)
+		bw.WriteByte(' ')
+		bw.WriteString(helpEscaper.Replace(f.help))
+		bw.WriteString("\n# TYPE ")
+		bw.WriteString(f.name)
+		bw.WriteByte(' ')
+		bw.WriteString(f.typ)
+		bw.WriteByte('\n')
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(s.labels[i])
+					bw.WriteString(`="`)
+					bw.WriteString(labelEscaper.Replace(s.labels[i+1]))
+					bw.WriteByte('"')
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
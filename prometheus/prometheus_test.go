@@ -0,0 +1,97 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func testModel() *pgmetrics.Model {
+	rotational := false
+	return &pgmetrics.Model{
+		Metadata: pgmetrics.Metadata{
+			Version:   "1.22",
+			At:        1700000000,
+			UserAgent: "pgmetrics/test",
+			Mode:      "postgres",
+			Local:     true,
+		},
+		StartTime: 1699990000,
+		Databases: []pgmetrics.Database{
+			{Name: "app", NumBackends: 3, Size: 8192, XactCommit: 100},
+		},
+		Tablespaces: []pgmetrics.Tablespace{
+			{Name: "pg_default", Size: 4096, MountPoint: "/", DiskUsed: 10, DiskTotal: 100},
+			{Name: `fast "ssd"`, Size: 2048},
+		},
+		Tables: []pgmetrics.Table{
+			{DBName: "app", SchemaName: "public", Name: "orders", SeqScan: 5, Size: 1024, Bloat: -1},
+			{DBName: "app", SchemaName: `odd\schema`, Name: "multi\nline", SeqScan: 1, Size: -1, Bloat: 512},
+		},
+		System: &pgmetrics.SystemMetrics{
+			Hostname: "db1",
+			NumCores: 4,
+			LoadAvg:  0.5,
+			DiskStats: []pgmetrics.DiskStats{
+				{DeviceName: "sda", ReadsCompleted: 10, ReadTime: 1500, Scheduler: "mq-deadline",
+					QueueDepth: 64, ReadAheadKB: 128, Rotational: &rotational},
+				{DeviceName: "nvme0n1", WritesCompleted: 20, SampleSeconds: 1, WritesPerSec: 20, Utilization: 12.5},
+			},
+			Warnings: []string{"something failed"},
+		},
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, testModel()); err != nil {
+		t.Fatal(err)
+	}
+
+	const golden = "testdata/model.prom"
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("output differs from %s (run with -update to regenerate):\n%s", golden, got)
+	}
+
+	// each family must appear once, with all its samples
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			if seen[name] {
+				t.Errorf("family repeated: %s", name)
+			}
+			seen[name] = true
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package stream reads the output written by the collector in streaming mode
+// (see collector.CollectConfig.StreamOutput).
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/rapidloop/pgmetrics"
+)
+
+// ErrorSection is the name of the section that ReadStream sends as the last
+// one if the stream could not be read to the end, see Err.
+const ErrorSection = "error"
+
+// ReadStream reads the newline-delimited sections of a pgmetrics stream from
+// r, and sends them over the returned channel as they are read. The first
+// section is read before returning, and an error is returned if it cannot be
+// read.
+//
+// The channel is closed after the "end" section, which is the last section
+// of a complete stream. If the stream cannot be read up to and including the
+// "end" section, an ErrorSection is sent as the last one instead, see Err.
+// The caller must receive from the channel until it is closed, or use
+// ReadStreamContext to stop early.
+func ReadStream(r io.Reader) (<-chan pgmetrics.ModelSection, error) {
+	return ReadStreamContext(context.Background(), r)
+}
+
+// ReadStreamContext is like ReadStream, but stops reading and closes the
+// channel once ctx is done, after which the caller need not receive from it.
+// A read from r that is in progress is not interrupted, close r for that.
+func ReadStreamContext(ctx context.Context, r io.Reader) (<-chan pgmetrics.ModelSection, error) {
+	dec := json.NewDecoder(r)
+	var first pgmetrics.ModelSection
+	if err := dec.Decode(&first); err == io.EOF {
+		return nil, errors.New("empty stream")
+	} else if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan pgmetrics.ModelSection)
+	go func() {
+		defer close(ch)
+		s := first
+		for {
+			select {
+			case ch <- s:
+			case <-ctx.Done():
+				return
+			}
+			if s.Section == "end" || s.Section == ErrorSection {
+				return
+			}
+			s = pgmetrics.ModelSection{}
+			if err := dec.Decode(&s); err == io.EOF {
+				s = errorSection(errors.New("stream ended without an \"end\" section"))
+			} else if err != nil {
+				s = errorSection(err)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// errorSection returns an ErrorSection for err.
+func errorSection(err error) pgmetrics.ModelSection {
+	data, _ := json.Marshal(err.Error())
+	return pgmetrics.ModelSection{Section: ErrorSection, Data: data}
+}
+
+// Err returns the error reported by an ErrorSection, or nil if s is some other
+// section.
+func Err(s pgmetrics.ModelSection) error {
+	if s.Section != ErrorSection {
+		return nil
+	}
+	var msg string
+	if err := json.Unmarshal(s.Data, &msg); err != nil {
+		msg = string(s.Data)
+	}
+	return errors.New(msg)
+}
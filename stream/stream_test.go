@@ -0,0 +1,108 @@
+/*
+ * Copyright 2025 RapidLoop, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stream
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+const sampleStream = `{"section":"cluster","data":{"meta":{"version":"1.22"}}}
+{"section":"tables","db_name":"app","data":[{"oid":1}]}
+{"section":"end","data":{}}
+`
+
+// readAll returns the names of the sections read from input, and the error
+// from the last section, if any.
+func readAll(t *testing.T, input string) (names []string, err error) {
+	t.Helper()
+	ch, err := ReadStream(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := range ch {
+		names = append(names, s.Section)
+		err = Err(s)
+	}
+	return
+}
+
+func TestReadStream(t *testing.T) {
+	names, err := readAll(t, sampleStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "cluster,tables,end" {
+		t.Errorf("got sections %s", got)
+	}
+}
+
+func TestReadStreamTruncated(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"mid-section", sampleStream[:strings.Index(sampleStream, "\n")+20]},
+		{"no end section", sampleStream[:strings.LastIndex(sampleStream, `{"section":"end"`)]},
+		{"garbage", sampleStream[:strings.Index(sampleStream, "\n")+1] + "not json\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := readAll(t, tc.input)
+			if err == nil {
+				t.Fatalf("no error for truncated stream, got sections %v", names)
+			}
+			if names[0] != "cluster" || names[len(names)-1] != ErrorSection {
+				t.Errorf("got sections %v", names)
+			}
+		})
+	}
+}
+
+func TestReadStreamEmpty(t *testing.T) {
+	if _, err := ReadStream(strings.NewReader("")); err == nil {
+		t.Error("no error for empty stream")
+	}
+	if _, err := ReadStream(strings.NewReader("{")); err == nil {
+		t.Error("no error for unreadable first section")
+	}
+}
+
+func TestReadStreamContext(t *testing.T) {
+	// a stream that never ends
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		for {
+			if _, err := io.WriteString(pw, `{"section":"tables","data":[]}`+"\n"); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := ReadStreamContext(ctx, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	cancel()
+	for range ch { // must be closed after a few more sections at most
+	}
+}